@@ -7,7 +7,45 @@ import (
 	"nparam/nparamcli"
 )
 
+const usage = `usage:
+  nparam                                build
+  nparam watch                          build whenever inputs change
+  nparam export-texts <locale> <file>   export texts to translate (.xlf, .xliff, .po)
+  nparam import-texts <locale> <file>   import translated texts, and build`
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "watch" {
+		err := nparamcli.Watch(true)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 &&
+		(os.Args[1] == "export-texts" || os.Args[1] == "import-texts") {
+		if len(os.Args) != 4 {
+			fmt.Println(usage)
+			os.Exit(2)
+		}
+		var err error
+		if os.Args[1] == "export-texts" {
+			err = nparamcli.ExportTexts(os.Args[2], os.Args[3], true)
+		} else {
+			err = nparamcli.ImportTexts(os.Args[2], os.Args[3], true)
+		}
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		fmt.Println("OK")
+		return
+	}
+	if len(os.Args) > 1 {
+		fmt.Println(usage)
+		os.Exit(2)
+	}
+
 	err := nparamcli.Process(false, true)
 	if err != nil {
 		fmt.Println(err.Error())
@@ -2,7 +2,9 @@ package nparamcli
 
 import (
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/bluegol/errutil"
 )
@@ -13,8 +15,17 @@ type config struct {
 	Lang         []string
 	ProtoPackage string
 	ProtoTypePrefix string
+	Sources      []*sourceDef
+	// time zone of $datetime values without offset, such as Asia/Seoul.
+	// UTC if not set.
+	TimeZone     string
+	// locale of $text values in tables. en if not set.
+	TextLocale   string
+	// locales to which $text values are translated.
+	Locales      []string
 
 	goout, csout bool
+	location     *time.Location
 }
 
 func loadConfig(fn string) (*config, error) {
@@ -42,6 +53,30 @@ func loadConfig(fn string) (*config, error) {
 		}
 	}
 
+	c.location = time.UTC
+	if len(c.TimeZone) > 0 {
+		c.location, err = time.LoadLocation(c.TimeZone)
+		if err != nil {
+			return nil, errutil.Embed(ErrConfigFile, err,
+				errutil.MoreInfo, "invalid time zone",
+				"timezone", c.TimeZone, "file", fn)
+		}
+	}
+
+	if len(c.TextLocale) == 0 {
+		c.TextLocale = defaultTextLocale
+	}
+
+	if len(c.Sources) == 0 {
+		c.Sources = defaultSources()
+	}
+	for _, s := range c.Sources {
+		err = s.normalize()
+		if err != nil {
+			return nil, errutil.AddInfo(err, "file", fn)
+		}
+	}
+
 	return &c, nil
 }
 
@@ -53,7 +88,7 @@ func (c *config) serverCmdField() string {
 	return c.ServerUrl + "/field/"
 }
 
-const innerVer = 1
+const innerVer = 2
 
 const (
 	workDir = "Work/"
@@ -61,8 +96,11 @@ const (
 	binDir = "Bin/"
 
 	extXlsx = ".xlsx"
+	extOds = ".ods"
 	extConst = ".const"
 	extTable = ".table"
+	extCsv = ".csv"
+	extTsv = ".tsv"
 
 	extInputInfoFileName = ".iinfo"
 
@@ -84,6 +122,7 @@ const (
 
 	// for both symbol and proto type
 	pfxSubType = "SubType_"
+	pfxEnumType = "Enum_"
 )
 
 func configFileName() string {
@@ -110,12 +149,21 @@ func tableListFileName() string {
 	return workDir + "_tables"
 }
 
+// flatFileName turns path of input file into a file name, so that
+// intermediate files of inputs in different directories don't collide.
+func flatFileName(fn string) string {
+	return flatFnReplacer.Replace(filepath.ToSlash(filepath.Clean(fn)))
+}
+
 func intermediateConstFileName(fn string) string {
-	return workDir + fn + extConst
+	return workDir + flatFileName(fn) + extConst
 }
 
 func tableMetaFileName(fn, tblName string) string {
-	_, fnOnly, _ := DecomposePath(fn)
+	dir, fnOnly, _ := DecomposePath(fn)
+	// table name is decomposed from tm file name by extension,
+	// so there must be no dot in the rest.
+	fnOnly = strings.Replace(flatFileName(dir + fnOnly), ".", "%2E", -1)
 	return workDir + tblName + "." + fnOnly + extTableMeta
 }
 
@@ -175,3 +223,5 @@ func initPath() error {
 	}
 	return nil
 }
+
+var flatFnReplacer = strings.NewReplacer("%", "%25", "/", "%2F")
@@ -0,0 +1,61 @@
+package nparamcli
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/bluegol/errutil"
+)
+
+// ParseCsv reads csv or tsv file, and extracts consts and tables
+// the same way as a worksheet of xlsx file.
+func ParseCsv(fn string, comma rune) ([]*cdef, []*tableMeta, [][][]string, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, nil, nil, errutil.Embed(ErrCannotOpen, err, "file", fn)
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.Comma = comma
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	cells, err := r.ReadAll()
+	if err != nil {
+		return nil, nil, nil, errutil.Embed(ErrCannotReadCsv, err, "file", fn)
+	}
+	if len(cells) > 0 && len(cells[0]) > 0 {
+		// utf-8 bom
+		cells[0][0] = strings.TrimPrefix(cells[0][0], "\ufeff")
+	}
+
+	loc := func(r, c int) string {
+		return csvLoc(fn, r, c)
+	}
+	cdefs, err := extractConsts(loc, cells)
+	if err != nil {
+		return nil, nil, nil, errutil.AddInfo(err, "file", fn)
+	}
+	tms, tds, err := extractTables(fn, loc, cells)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	tables := map[string]*tableMeta{}
+	for _, tm := range tms {
+		prev, exists := tables[tm.Name]
+		if exists {
+			return nil, nil, nil, errutil.New(ErrDuplicateTblNames,
+				"table", tm.Name,
+				"loc", tm.XlsxLoc, "prev_loc", prev.XlsxLoc)
+		}
+		tables[tm.Name] = tm
+	}
+
+	return cdefs, tms, tds, nil
+}
+
+func csvLoc(fn string, r, c int) string {
+	return fmt.Sprintf("%s!R%dC%d", fn, r+1, c+1)
+}
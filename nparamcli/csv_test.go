@@ -0,0 +1,99 @@
+package nparamcli
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseCsv(t *testing.T) {
+	tests := []struct {
+		name    string
+		comma   rune
+		content string
+		data    [][]string
+	}{
+		{
+			name:  "csv",
+			comma: ',',
+			content: "\ufeff$const,MaxLevel,100\r\n" +
+				"$table,Item\r\n" +
+				"id,hp,desc,$end\r\n" +
+				"$autokey,$int,$string\r\n" +
+				"Sword,10,\"a \"\"big\"\",\nsword\"\r\n" +
+				"Bow,7,say \"hi\"\r\n" +
+				"$end\r\n",
+			data: [][]string{
+				{ "Sword", "10", "a \"big\",\nsword" },
+				{ "Bow", "7", "say \"hi\"" },
+			},
+		},
+		{
+			name:  "tsv",
+			comma: '\t',
+			content: "\ufeff$const\tMaxLevel\t100\n" +
+				"$table\tItem\n" +
+				"id\thp\tdesc\t$end\n" +
+				"$autokey\t$int\t$string\n" +
+				"Sword\t10\t\"a, b\nc\"\n" +
+				"Bow\t7\ta, \"b\"\n" +
+				"$end\n",
+			data: [][]string{
+				{ "Sword", "10", "a, b\nc" },
+				{ "Bow", "7", "a, \"b\"" },
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fn := writeTestFile(t, "a" + extCsv, tt.content)
+			cdefs, tms, tds, err := ParseCsv(fn, tt.comma)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(cdefs) != 1 || cdefs[0].Name != "MaxLevel" || cdefs[0].Value != 100 {
+				t.Fatalf("consts: %+v", cdefs)
+			}
+			if cdefs[0].XlsxLoc != fn + "!R1C2" {
+				t.Errorf("const loc %q", cdefs[0].XlsxLoc)
+			}
+			if len(tms) != 1 || tms[0].Name != "Item" {
+				t.Fatalf("tables: %v", tms)
+			}
+			if tms[0].XlsxLoc != fn + "!R2C1" {
+				t.Errorf("table loc %q", tms[0].XlsxLoc)
+			}
+			if ! reflect.DeepEqual(tds[0], tt.data) {
+				t.Errorf("data %q, want %q", tds[0], tt.data)
+			}
+		})
+	}
+}
+
+func TestParseCsvErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    error
+	}{
+		{ "const not int", "$const,A,x\n", ErrXlsxInvalidConstDef },
+		{ "no table end", "$table,T\nid,$end\n$int\n1\n", ErrXlsxInvalidTableDef },
+		{
+			"duplicate table",
+			"$table,T\nid,$end\n$int\n1\n$end\n$table,T\nid,$end\n$int\n1\n$end\n",
+			ErrDuplicateTblNames,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fn := writeTestFile(t, "a" + extCsv, tt.content)
+			_, _, _, err := ParseCsv(fn, ',')
+			if err == nil {
+				t.Fatal("no error")
+			}
+			if ! strings.Contains(err.Error(), tt.want.Error()) {
+				t.Errorf("error %q, want %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -13,6 +13,7 @@ var (
 
 	ErrCannotOpen      error
 	ErrCannotReadXlsx  error
+	ErrCannotReadCsv   error
 	ErrCannotCreate    error
 	ErrCannotWrite     error
 
@@ -48,6 +49,7 @@ func init() {
 
 	ErrCannotOpen = errors.New("파일 오픈 실패함")
 	ErrCannotReadXlsx = errors.New("엑셀 파일을 읽을 수 없음")
+	ErrCannotReadCsv = errors.New("csv 파일을 읽을 수 없음")
 	ErrCannotCreate = errors.New("파일 생성 실패함")
 	ErrCannotWrite = errors.New("파일 쓰기 실패함")
 
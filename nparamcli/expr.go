@@ -0,0 +1,492 @@
+package nparamcli
+
+// values of int, fixed4 and float types can be arithmetic expressions
+// such as BaseHp * 3 / 2 + Tuning.bonus, with +, -, *, /, parentheses
+// and functions min(a, b, ...), max(a, b, ...), clamp(x, lo, hi).
+// each operand is a literal with optional unit, a const or an SRTable
+// reference, and is resolved as a value of the field type.
+// int division truncates toward zero. for fixed4, operands are scaled
+// values and the results of * and / are scaled back, so that
+// 1.5 * 3 is 4.5.
+// in list and map values, , in the parentheses of functions doesn't
+// separate elements.
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"strconv"
+
+	"github.com/bluegol/errutil"
+)
+
+var ErrInvalidExpression error
+
+const (
+	tkNum = iota
+	tkIdent
+	tkOp
+	tkLParen
+	tkRParen
+	tkComma
+)
+
+type exprToken struct {
+	kind int
+	s    string
+}
+
+const (
+	exprFuncMin = "min"
+	exprFuncMax = "max"
+	exprFuncClamp = "clamp"
+)
+
+// exprNode is a node of parsed expression. op is one of
+// "" (operand), "+", "-", "*", "/", "neg" and function names.
+type exprNode struct {
+	op      string
+	operand string
+	args    []*exprNode
+}
+
+func tokenizeExpr(v string) ([]exprToken, error) {
+	tokens := []exprToken{}
+	i := 0
+	for i < len(v) {
+		c := v[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case isDigit(c) || (c == '.' && i+1 < len(v) && isDigit(v[i+1])):
+			j := i
+			for j < len(v) && (isDigit(v[j]) || v[j] == '.') {
+				j++
+			}
+			// exponent
+			if j < len(v) && (v[j] == 'e' || v[j] == 'E') {
+				k := j + 1
+				if k < len(v) && (v[k] == '+' || v[k] == '-') {
+					k++
+				}
+				if k < len(v) && isDigit(v[k]) {
+					for k < len(v) && isDigit(v[k]) {
+						k++
+					}
+					j = k
+				}
+			}
+			tokens = append(tokens, exprToken{ tkNum, v[i:j] })
+			i = j
+		case isIdentStart(c):
+			j := i
+			for j < len(v) && (isIdentStart(v[j]) || isDigit(v[j]) ||
+				v[j] == '.' || v[j] == '[' || v[j] == ']') {
+				j++
+			}
+			tokens = append(tokens, exprToken{ tkIdent, v[i:j] })
+			i = j
+		case c == '+' || c == '-' || c == '*' || c == '/':
+			tokens = append(tokens, exprToken{ tkOp, v[i:i+1] })
+			i++
+		case c == '(':
+			tokens = append(tokens, exprToken{ tkLParen, "(" })
+			i++
+		case c == ')':
+			tokens = append(tokens, exprToken{ tkRParen, ")" })
+			i++
+		case c == ',':
+			tokens = append(tokens, exprToken{ tkComma, "," })
+			i++
+		default:
+			return nil, errutil.New(ErrInvalidExpression,
+				errutil.MoreInfo, "invalid character",
+				"value", v, "pos", strconv.Itoa(i))
+		}
+	}
+	return tokens, nil
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isIdentStart(c byte) bool {
+	return ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || c == '_'
+}
+
+// IsExpression reports whether v is an expression rather than
+// a single operand, i.e. a literal with optional sign and unit,
+// a const or an SRTable reference.
+func IsExpression(v string) bool {
+	tokens, err := tokenizeExpr(v)
+	if err != nil || len(tokens) == 0 {
+		return false
+	}
+	if tokens[0].kind == tkOp && (tokens[0].s == "-" || tokens[0].s == "+") {
+		tokens = tokens[1:]
+		if len(tokens) == 0 || tokens[0].kind != tkNum {
+			return true
+		}
+	}
+	switch len(tokens) {
+	case 1:
+		return tokens[0].kind != tkNum && tokens[0].kind != tkIdent
+	case 2:
+		return tokens[0].kind != tkNum || tokens[1].kind != tkIdent
+	default:
+		return true
+	}
+}
+
+type exprParser struct {
+	v      string
+	tokens []exprToken
+	pos    int
+}
+
+func ParseExpr(v string) (*exprNode, error) {
+	tokens, err := tokenizeExpr(v)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{ v: v, tokens: tokens }
+	n, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, p.errorf("unexpected " + p.tokens[p.pos].s)
+	}
+	return n, nil
+}
+
+func (p *exprParser) errorf(msg string) error {
+	return errutil.New(ErrInvalidExpression,
+		errutil.MoreInfo, msg, "value", p.v)
+}
+
+func (p *exprParser) peek() *exprToken {
+	if p.pos < len(p.tokens) {
+		return &p.tokens[p.pos]
+	}
+	return nil
+}
+
+// expr := term (('+'|'-') term)*
+func (p *exprParser) expr() (*exprNode, error) {
+	n, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tk := p.peek()
+		if tk == nil || tk.kind != tkOp || (tk.s != "+" && tk.s != "-") {
+			return n, nil
+		}
+		p.pos++
+		rhs, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		n = &exprNode{ op: tk.s, args: []*exprNode{ n, rhs } }
+	}
+}
+
+// term := unary (('*'|'/') unary)*
+func (p *exprParser) term() (*exprNode, error) {
+	n, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tk := p.peek()
+		if tk == nil || tk.kind != tkOp || (tk.s != "*" && tk.s != "/") {
+			return n, nil
+		}
+		p.pos++
+		rhs, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		n = &exprNode{ op: tk.s, args: []*exprNode{ n, rhs } }
+	}
+}
+
+// unary := ('+'|'-') unary | primary
+func (p *exprParser) unary() (*exprNode, error) {
+	tk := p.peek()
+	if tk != nil && tk.kind == tkOp && (tk.s == "+" || tk.s == "-") {
+		p.pos++
+		n, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		if tk.s == "+" {
+			return n, nil
+		}
+		return &exprNode{ op: "neg", args: []*exprNode{ n } }, nil
+	}
+	return p.primary()
+}
+
+// primary := num [unit] | func '(' expr (',' expr)* ')' | ident | '(' expr ')'
+func (p *exprParser) primary() (*exprNode, error) {
+	tk := p.peek()
+	if tk == nil {
+		return nil, p.errorf("unexpected end")
+	}
+	p.pos++
+	switch tk.kind {
+	case tkNum:
+		operand := tk.s
+		next := p.peek()
+		if next != nil && next.kind == tkIdent {
+			// unit
+			operand += " " + next.s
+			p.pos++
+		}
+		return &exprNode{ operand: operand }, nil
+	case tkIdent:
+		next := p.peek()
+		if next == nil || next.kind != tkLParen {
+			return &exprNode{ operand: tk.s }, nil
+		}
+		p.pos++
+		return p.call(tk.s)
+	case tkLParen:
+		n, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		next := p.peek()
+		if next == nil || next.kind != tkRParen {
+			return nil, p.errorf("missing )")
+		}
+		p.pos++
+		return n, nil
+	default:
+		return nil, p.errorf("unexpected " + tk.s)
+	}
+}
+
+func (p *exprParser) call(fn string) (*exprNode, error) {
+	if fn != exprFuncMin && fn != exprFuncMax && fn != exprFuncClamp {
+		return nil, p.errorf("unknown function " + fn)
+	}
+	n := &exprNode{ op: fn }
+	for {
+		arg, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		n.args = append(n.args, arg)
+		tk := p.peek()
+		if tk == nil {
+			return nil, p.errorf("missing )")
+		}
+		p.pos++
+		if tk.kind == tkRParen {
+			break
+		}
+		if tk.kind != tkComma {
+			return nil, p.errorf("unexpected " + tk.s)
+		}
+	}
+	if fn == exprFuncClamp && len(n.args) != 3 {
+		return nil, p.errorf("clamp needs 3 arguments")
+	}
+	return n, nil
+}
+
+// operands returns operands of the expression.
+func (n *exprNode) operands() []string {
+	if len(n.op) == 0 {
+		return []string{ n.operand }
+	}
+	result := []string{}
+	for _, arg := range n.args {
+		result = append(result, arg.operands()...)
+	}
+	return result
+}
+
+// ValueOperands returns the operands if v is an expression,
+// or v itself otherwise.
+func ValueOperands(v string) []string {
+	if ! IsExpression(v) {
+		return []string{ v }
+	}
+	n, err := ParseExpr(v)
+	if err != nil {
+		// reported when resolving values
+		return nil
+	}
+	return n.operands()
+}
+
+/////////////////////////////////////////////////////////////////////
+
+// resolveIntExpr evaluates expression v as a value of int type t.
+func (proc *processor) resolveIntExpr(
+	v string, t int, units map[string]int) (int, error) {
+
+	n, err := ParseExpr(v)
+	if err != nil {
+		return 0, err
+	}
+	r, err := proc.evalIntExpr(n, t, units)
+	if err != nil {
+		return 0, errutil.AddInfo(err, "expression", v)
+	}
+	abs := new(big.Int).Abs(r)
+	if ! abs.IsUint64() {
+		return 0, errutil.New(ErrIntOutOfRange,
+			"value", v, "result", r.String(), "type", typeString(t))
+	}
+	result, ok := intInRange(t, r.Sign() < 0, abs.Uint64())
+	if ! ok {
+		return 0, errutil.New(ErrIntOutOfRange,
+			"value", v, "result", r.String(), "type", typeString(t))
+	}
+	return result, nil
+}
+
+func (proc *processor) evalIntExpr(
+	n *exprNode, t int, units map[string]int) (*big.Int, error) {
+
+	if len(n.op) == 0 {
+		iv, err := proc.resolveInt(n.operand, t, units)
+		if err != nil {
+			return nil, err
+		}
+		if t == vtUint64 {
+			return new(big.Int).SetUint64(uint64(iv)), nil
+		}
+		return big.NewInt(int64(iv)), nil
+	}
+
+	args := make([]*big.Int, len(n.args))
+	for k, arg := range n.args {
+		var err error
+		args[k], err = proc.evalIntExpr(arg, t, units)
+		if err != nil {
+			return nil, err
+		}
+	}
+	scale := big.NewInt(1)
+	if t == vtFixed4 {
+		scale = big.NewInt(Fixed4Mult)
+	}
+	r := new(big.Int)
+	switch n.op {
+	case "neg":
+		r.Neg(args[0])
+	case "+":
+		r.Add(args[0], args[1])
+	case "-":
+		r.Sub(args[0], args[1])
+	case "*":
+		r.Mul(args[0], args[1])
+		r.Quo(r, scale)
+	case "/":
+		if args[1].Sign() == 0 {
+			return nil, errutil.New(ErrInvalidExpression,
+				errutil.MoreInfo, "division by zero")
+		}
+		r.Mul(args[0], scale)
+		r.Quo(r, args[1])
+	case exprFuncMin, exprFuncMax:
+		r.Set(args[0])
+		for _, a := range args[1:] {
+			if (n.op == exprFuncMin) == (a.Cmp(r) < 0) {
+				r.Set(a)
+			}
+		}
+	case exprFuncClamp:
+		if args[1].Cmp(args[2]) > 0 {
+			return nil, errutil.New(ErrInvalidExpression,
+				errutil.MoreInfo, "clamp lower bound is greater than upper bound")
+		}
+		r.Set(args[0])
+		if r.Cmp(args[1]) < 0 {
+			r.Set(args[1])
+		} else if r.Cmp(args[2]) > 0 {
+			r.Set(args[2])
+		}
+	default:
+		return nil, errutil.NewAssert("op", n.op)
+	}
+	return r, nil
+}
+
+// resolveFloatExpr evaluates expression v as a float value.
+func (proc *processor) resolveFloatExpr(
+	v string, units map[string]int) (float64, error) {
+
+	n, err := ParseExpr(v)
+	if err != nil {
+		return 0, err
+	}
+	f, err := proc.evalFloatExpr(n, units)
+	if err != nil {
+		return 0, errutil.AddInfo(err, "expression", v)
+	}
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return 0, errutil.New(ErrFloatOutOfRange, "value", v)
+	}
+	return f, nil
+}
+
+func (proc *processor) evalFloatExpr(
+	n *exprNode, units map[string]int) (float64, error) {
+
+	if len(n.op) == 0 {
+		return proc.resolveFloat(n.operand, units)
+	}
+
+	args := make([]float64, len(n.args))
+	for k, arg := range n.args {
+		var err error
+		args[k], err = proc.evalFloatExpr(arg, units)
+		if err != nil {
+			return 0, err
+		}
+	}
+	switch n.op {
+	case "neg":
+		return -args[0], nil
+	case "+":
+		return args[0] + args[1], nil
+	case "-":
+		return args[0] - args[1], nil
+	case "*":
+		return args[0] * args[1], nil
+	case "/":
+		if args[1] == 0 {
+			return 0, errutil.New(ErrInvalidExpression,
+				errutil.MoreInfo, "division by zero")
+		}
+		return args[0] / args[1], nil
+	case exprFuncMin, exprFuncMax:
+		r := args[0]
+		for _, a := range args[1:] {
+			if (n.op == exprFuncMin) == (a < r) {
+				r = a
+			}
+		}
+		return r, nil
+	case exprFuncClamp:
+		if args[1] > args[2] {
+			return 0, errutil.New(ErrInvalidExpression,
+				errutil.MoreInfo, "clamp lower bound is greater than upper bound")
+		}
+		return math.Min(math.Max(args[0], args[1]), args[2]), nil
+	default:
+		return 0, errutil.NewAssert("op", n.op)
+	}
+}
+
+func init() {
+	ErrInvalidExpression = errors.New("잘못된 수식")
+}
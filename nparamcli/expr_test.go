@@ -0,0 +1,121 @@
+package nparamcli
+
+import (
+	"strings"
+	"testing"
+)
+
+// exprString returns n in prefix notation, such as (+ 1 (* 2 3)).
+func exprString(n *exprNode) string {
+	if len(n.op) == 0 {
+		return n.operand
+	}
+	parts := []string{ n.op }
+	for _, arg := range n.args {
+		parts = append(parts, exprString(arg))
+	}
+	return "(" + strings.Join(parts, " ") + ")"
+}
+
+func TestParseExpr(t *testing.T) {
+	tests := []struct {
+		v     string
+		want  string
+		err   bool
+	}{
+		{ "1 + 2 * 3", "(+ 1 (* 2 3))", false },
+		{ "(1 + 2) * 3", "(* (+ 1 2) 3)", false },
+		{ "1 - 2 - 3", "(- (- 1 2) 3)", false },
+		{ "-A / +2", "(/ (neg A) 2)", false },
+		{ "3k * Hp.base", "(* 3 k Hp.base)", false },
+		{ "Item[Sword].hp + 1", "(+ Item[Sword].hp 1)", false },
+		{ "min(A, B, 3) + max(1,2)", "(+ (min A B 3) (max 1 2))", false },
+		{ "clamp(X * 2, 0, 10)", "(clamp (* X 2) 0 10)", false },
+		{ "1 +", "", true },
+		{ "(1 + 2", "", true },
+		{ "1 + 2)", "", true },
+		{ "min(1, 2", "", true },
+		{ "min()", "", true },
+		{ "clamp(1, 2)", "", true },
+		{ "avg(1, 2)", "", true },
+		{ "1 % 2", "", true },
+		{ "1 , 2", "", true },
+	}
+	for _, tt := range tests {
+		n, err := ParseExpr(tt.v)
+		if tt.err {
+			if err == nil ||
+				! strings.Contains(err.Error(), ErrInvalidExpression.Error()) {
+				t.Errorf("ParseExpr(%q): error %v, want %v",
+					tt.v, err, ErrInvalidExpression)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseExpr(%q): %v", tt.v, err)
+			continue
+		}
+		got := exprString(n)
+		if got != tt.want {
+			t.Errorf("ParseExpr(%q) = %s, want %s", tt.v, got, tt.want)
+		}
+	}
+}
+
+func TestEvalIntExpr(t *testing.T) {
+	proc := newTestProcessor(t, map[string]int{ "Base": 100, "Big": 1 << 40 })
+	units := map[string]int{ "k": 1000 }
+	tests := []struct {
+		v     string
+		typ   int
+		want  int
+		err   error
+	}{
+		{ "Base * 3 / 2 + 1", vtInt, 151, nil },
+		{ "7 / 2", vtInt, 3, nil },
+		{ "-7 / 2", vtInt, -3, nil },
+		{ "2k - Base", vtInt, 1900, nil },
+		{ "min(Base, 50, 70)", vtInt, 50, nil },
+		{ "max(Base, 50) * 2", vtInt, 200, nil },
+		{ "clamp(Base, 0, 10)", vtInt, 10, nil },
+		{ "clamp(-Base, 0, 10)", vtInt, 0, nil },
+		{ "clamp(1, 10, 0)", vtInt, 0, ErrInvalidExpression },
+		{ "1 / (Base - 100)", vtInt, 0, ErrInvalidExpression },
+		{ "Big + 1", vtInt, 0, ErrIntOutOfRange },
+		{ "Big / 1024 - 1", vtInt64, 1<<30 - 1, nil },
+		{ "100000 * 100000 / 100000", vtInt, 100000, nil },
+		{ "Big * Big / Big", vtInt64, 1 << 40, nil },
+		{ "0 - 1", vtUint32, 0, ErrIntOutOfRange },
+		{ "4294967295 + 0", vtUint32, 4294967295, nil },
+		{ "18446744073709551615 - 1", vtUint64, -2, nil },
+		{ "1.5 * 3", vtFixed4, 45000, nil },
+		{ "1.5 * 1.5", vtFixed4, 22500, nil },
+		{ "3 / 2", vtFixed4, 15000, nil },
+		{ "1 / 3", vtFixed4, 3333, nil },
+		{ "-1 / 3", vtFixed4, -3333, nil },
+		{ "0.5k * 2", vtFixed4, 10000000, nil },
+		{ "min(1.25, 1.5) + 1", vtFixed4, 22500, nil },
+		{ "200000 * 2", vtFixed4, 0, ErrIntOutOfRange },
+		{ "Base * 2", vtFixed4, 0, ErrInvalidInt },
+		{ "1.5 * 2", vtInt, 0, ErrInvalidInt },
+		{ "Unknown + 1", vtInt, 0, ErrInvalidInt },
+	}
+	for _, tt := range tests {
+		got, err := proc.resolveInt(tt.v, tt.typ, units)
+		if tt.err != nil {
+			if err == nil || ! strings.Contains(err.Error(), tt.err.Error()) {
+				t.Errorf("resolveInt(%q, %s): error %v, want %v",
+					tt.v, typeString(tt.typ), err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("resolveInt(%q, %s): %v", tt.v, typeString(tt.typ), err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("resolveInt(%q, %s) = %d, want %d",
+				tt.v, typeString(tt.typ), got, tt.want)
+		}
+	}
+}
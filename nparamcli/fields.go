@@ -17,11 +17,32 @@ const (
 	kwFieldTypeInt = "$int"
 	kwFieldTypeFixed4 = "$fixed4"
 	kwFieldTypeString = "$string"
+	kwFieldTypeBool = "$bool"
+	kwFieldTypeFloat = "$float"
+	kwFieldTypeDouble = "$double"
+	kwFieldTypeInt64 = "$int64"
+	kwFieldTypeUint32 = "$uint32"
+	kwFieldTypeUint64 = "$uint64"
+	kwFieldTypeEnum = "$enum"
+	kwFieldTypeMap = "$map"
+	kwFieldTypeDuration = "$duration"
+	kwFieldTypeDatetime = "$datetime"
+	kwFieldTypeText = "$text"
 
 	kwFieldOptCoverAll = "$coverall"
 	kwFieldOptMin = "$min"
 	kwFieldOptMax = "$max"
 	kwFieldOptUnit = "$unit"
+	kwFieldOptZigZag = "$zigzag"
+	kwFieldOptList = "$list"
+	kwFieldOptMinLen = "$minlen"
+	kwFieldOptMaxLen = "$maxlen"
+	kwFieldOptDefault = "$default"
+	kwFieldOptOptional = "$optional"
+	kwFieldOptPattern = "$pattern"
+	kwFieldOptNonEmpty = "$nonempty"
+	kwFieldOptUnique = "$unique"
+	kwFieldOptRef = "$ref"
 )
 
 const (
@@ -30,28 +51,56 @@ const (
 	vtInt = 2
 	vtFixed4 = 3
 	vtString = 4
+	vtBool = 5
+	vtFloat = 6
+	vtDouble = 7
+	vtInt64 = 8
+	vtUint32 = 9
+	vtUint64 = 10
+	vtEnum = 11
+	vtMap = 12
+	vtDuration = 13
+	vtDatetime = 14
+	vtText = 15
 
-	vtMax = 5
+	vtMax = 16
 )
 var typeStrings [vtMax]string =
-	[...]string{ "NO TYPE", "id", "int", "fixed4", "string" }
+	[...]string{ "NO TYPE", "id", "int", "fixed4", "string", "bool",
+		"float", "double", "int64", "uint32", "uint64", "enum", "map",
+		"duration", "datetime", "text" }
 
 var ErrInvalidFieldDef error
 
-func DecomposeFieldName(fName string) (string, int, string) {
-	m := reFieldName.FindStringSubmatch(fName)
-	if m == nil {
-		return "", -1, ""
-	}
-	i := -1
-	if len(m[3]) > 0 {
-		var err error
-		i, err = strconv.Atoi(m[3])
-		if err != nil {
-			return "", -1, ""
+// fieldNameElem is an element of field name separated by ".",
+// such as items[2] in reward[0].items[2].count.
+type fieldNameElem struct {
+	Name  string
+	// -1 if not array
+	Index int
+}
+
+// DecomposeFieldName splits field name into its elements.
+// returns nil if the name is invalid.
+func DecomposeFieldName(fName string) []fieldNameElem {
+	parts := strings.Split(fName, ".")
+	elems := make([]fieldNameElem, len(parts))
+	for k, part := range parts {
+		m := reFieldName.FindStringSubmatch(part)
+		if m == nil {
+			return nil
+		}
+		i := -1
+		if len(m[3]) > 0 {
+			var err error
+			i, err = strconv.Atoi(m[3])
+			if err != nil {
+				return nil
+			}
 		}
+		elems[k] = fieldNameElem{ Name: m[1], Index: i }
 	}
-	return m[1], i, m[5]
+	return elems
 }
 
 func typeString(t int) string {
@@ -63,11 +112,20 @@ func typeString(t int) string {
 }
 
 func setFieldTypeAndOpts(f *fieldDef, optStr string, keyField bool) error {
-	var err error
-	f.Opts, err = ParseOpt(optStr, fieldOpts1, fieldOpts2, fieldOpts3)
+	opts, err := ParseOpt(optStr, fieldOpts1, fieldOpts2, fieldOpts3)
 	if err != nil {
 		return err
 	}
+	return f.setTypeAndOpts(opts, keyField)
+}
+
+func (f *fieldDef) setTypeAndOpts(opts *Options, keyField bool) error {
+	var err error
+	f.Opts = opts
+	_, isMap := f.Opts.MultiValued[kwFieldTypeMap]
+	if isMap {
+		return f.setMap(keyField)
+	}
 
 	// set field type
 	f.AutoKey = false
@@ -82,6 +140,24 @@ func setFieldTypeAndOpts(f *fieldDef, optStr string, keyField bool) error {
 			err = f.setType(vtFixed4)
 		} else if k == kwFieldTypeString {
 			err = f.setType(vtString)
+		} else if k == kwFieldTypeBool {
+			err = f.setType(vtBool)
+		} else if k == kwFieldTypeFloat {
+			err = f.setType(vtFloat)
+		} else if k == kwFieldTypeDouble {
+			err = f.setType(vtDouble)
+		} else if k == kwFieldTypeInt64 {
+			err = f.setType(vtInt64)
+		} else if k == kwFieldTypeUint32 {
+			err = f.setType(vtUint32)
+		} else if k == kwFieldTypeUint64 {
+			err = f.setType(vtUint64)
+		} else if k == kwFieldTypeDuration {
+			err = f.setType(vtDuration)
+		} else if k == kwFieldTypeDatetime {
+			err = f.setType(vtDatetime)
+		} else if k == kwFieldTypeText {
+			err = f.setType(vtText)
 		}
 	}
 	for k, v := range f.Opts.MultiValued {
@@ -99,6 +175,15 @@ func setFieldTypeAndOpts(f *fieldDef, optStr string, keyField bool) error {
 					errutil.MoreInfo, "no table is specified for type " + kwFieldTypeKeysOf,
 					"field", f.Name)
 			}
+		} else if k == kwFieldTypeEnum {
+			err = f.setType(vtEnum)
+			if err != nil {
+				return err
+			}
+			err = f.setEnum(v)
+			if err != nil {
+				return err
+			}
 		}
 	}
 	if err != nil {
@@ -134,20 +219,25 @@ func setFieldTypeAndOpts(f *fieldDef, optStr string, keyField bool) error {
 					errutil.MoreInfo, "cannot set " + kwFieldOptCoverAll +" for autokey",
 					"field", f.Name )
 			}
+			if len(f.KeysOf) == 0 {
+				return errutil.New(ErrInvalidFieldDef,
+					errutil.MoreInfo, kwFieldOptCoverAll + " needs " + kwFieldTypeKeysOf,
+					"field", f.Name )
+			}
 			f.CoverAll = true
 		}
 	}
 	// set min, max, units
 	for k, v := range f.Opts.SingleValued {
 		if k == kwFieldOptMin {
-			if f.Type != vtInt && f.Type != vtFixed4 {
+			if ! f.isNumber() && ! f.isTime() {
 				return errutil.New(ErrInvalidFieldDef,
 					errutil.MoreInfo, "cannot set " + kwFieldOptMin,
 					"field", f.Name, "type", f.TypeString() )
 			}
 			f.MinStr = v
 		} else if k == kwFieldOptMax {
-			if f.Type != vtInt && f.Type != vtFixed4 {
+			if ! f.isNumber() && ! f.isTime() {
 				return errutil.New(ErrInvalidFieldDef,
 					errutil.MoreInfo, "cannot set " + kwFieldOptMax,
 					"field", f.Name, "type", f.TypeString() )
@@ -155,9 +245,173 @@ func setFieldTypeAndOpts(f *fieldDef, optStr string, keyField bool) error {
 			f.MaxStr = v
 		}
 	}
+	// set list
+	for k, _ := range f.Opts.WithoutValue {
+		if k == kwFieldOptList {
+			if keyField {
+				return errutil.New(ErrInvalidFieldDef,
+					errutil.MoreInfo, "key field cannot be " + kwFieldOptList,
+					"field", f.Name)
+			}
+			f.List = true
+		}
+	}
+	for k, v := range f.Opts.SingleValued {
+		if k == kwFieldOptMinLen || k == kwFieldOptMaxLen {
+			if ! f.List && ! f.isString() {
+				return errutil.New(ErrInvalidFieldDef,
+					errutil.MoreInfo, "cannot set " + k + " without " + kwFieldOptList,
+					"field", f.Name, "type", f.TypeString() )
+			}
+			l, err := strconv.Atoi(v)
+			if err != nil || l < 0 {
+				return errutil.New(ErrInvalidFieldDef,
+					errutil.MoreInfo, "invalid value of " + k,
+					"field", f.Name, "value", v)
+			}
+			if k == kwFieldOptMinLen {
+				f.MinLen = l
+			} else {
+				f.MaxLen = l
+			}
+		}
+	}
+	if f.MaxLen > 0 && f.MinLen > f.MaxLen {
+		return errutil.New(ErrInvalidFieldDef,
+			errutil.MoreInfo, kwFieldOptMinLen + " is greater than " + kwFieldOptMaxLen,
+			"field", f.Name)
+	}
+
+	// set pattern and nonempty
+	for k, v := range f.Opts.SingleValued {
+		if k == kwFieldOptPattern {
+			if ! f.isString() {
+				return errutil.New(ErrInvalidFieldDef,
+					errutil.MoreInfo, "cannot set " + k,
+					"field", f.Name, "type", f.TypeString() )
+			}
+			_, err := compilePattern(v)
+			if err != nil {
+				return errutil.Embed(ErrInvalidFieldDef, err,
+					errutil.MoreInfo, "invalid " + k,
+					"field", f.Name, "value", v)
+			}
+			f.Pattern = v
+		}
+	}
+	for k, _ := range f.Opts.WithoutValue {
+		if k == kwFieldOptNonEmpty {
+			if ! f.isString() {
+				return errutil.New(ErrInvalidFieldDef,
+					errutil.MoreInfo, "cannot set " + k,
+					"field", f.Name, "type", f.TypeString() )
+			}
+			f.NonEmpty = true
+		}
+	}
+
+	// set unique
+	for k, _ := range f.Opts.WithoutValue {
+		if k == kwFieldOptUnique {
+			if keyField {
+				return errutil.New(ErrInvalidFieldDef,
+					errutil.MoreInfo, "key field cannot have " + k,
+					"field", f.Name)
+			}
+			if f.List {
+				return errutil.New(ErrInvalidFieldDef,
+					errutil.MoreInfo, "cannot set " + k + " for " + kwFieldOptList,
+					"field", f.Name)
+			}
+			f.Unique = true
+		}
+	}
+
+	// set ref
+	for k, v := range f.Opts.SingleValued {
+		if k == kwFieldOptRef {
+			if keyField {
+				return errutil.New(ErrInvalidFieldDef,
+					errutil.MoreInfo, "key field cannot have " + k,
+					"field", f.Name)
+			}
+			if ! f.isInt() || f.Type == vtFixed4 {
+				return errutil.New(ErrInvalidFieldDef,
+					errutil.MoreInfo, "cannot set " + k,
+					"field", f.Name, "type", f.TypeString() )
+			}
+			err := CheckValidUserDefinedSymbol(v)
+			if err != nil {
+				return errutil.Embed(ErrInvalidFieldDef, err,
+					errutil.MoreInfo, "invalid table name of " + k,
+					"field", f.Name, "value", v)
+			}
+			f.Ref = v
+		}
+	}
+
+	// set default and optional
+	for k, _ := range f.Opts.WithoutValue {
+		if k == kwFieldOptOptional {
+			f.Optional = true
+		}
+	}
+	for k, v := range f.Opts.SingleValued {
+		if k == kwFieldOptDefault {
+			// empty default would be the same as no default
+			if len(v) == 0 {
+				return errutil.New(ErrInvalidFieldDef,
+					errutil.MoreInfo, "empty value of " + k,
+					"field", f.Name)
+			}
+			f.DefaultStr = v
+		}
+	}
+	if f.Optional || len(f.DefaultStr) > 0 {
+		var k string
+		if f.Optional {
+			k = kwFieldOptOptional
+		} else {
+			k = kwFieldOptDefault
+		}
+		if keyField {
+			return errutil.New(ErrInvalidFieldDef,
+				errutil.MoreInfo, "key field cannot have " + k,
+				"field", f.Name)
+		}
+		if f.List {
+			return errutil.New(ErrInvalidFieldDef,
+				errutil.MoreInfo, "cannot set " + k + " for " + kwFieldOptList,
+				"field", f.Name)
+		}
+		if f.Optional && f.NonEmpty {
+			return errutil.New(ErrInvalidFieldDef,
+				errutil.MoreInfo,
+				"cannot set " + kwFieldOptOptional + " and " + kwFieldOptNonEmpty,
+				"field", f.Name)
+		}
+		if f.Optional && len(f.DefaultStr) > 0 {
+			return errutil.New(ErrInvalidFieldDef,
+				errutil.MoreInfo,
+				"cannot set " + kwFieldOptOptional + " and " + kwFieldOptDefault,
+				"field", f.Name)
+		}
+	}
+
+	// set zigzag. also set in processTableMetas if min is negative
+	for k, _ := range f.Opts.WithoutValue {
+		if k == kwFieldOptZigZag {
+			if ! f.isSigned() {
+				return errutil.New(ErrInvalidFieldDef,
+					errutil.MoreInfo, "cannot set " + kwFieldOptZigZag,
+					"field", f.Name, "type", f.TypeString() )
+			}
+			f.ZigZag = true
+		}
+	}
 	for k, v := range f.Opts.MultiValued {
 		if k == kwFieldOptUnit {
-			if f.Type != vtInt && f.Type != vtFixed4 {
+			if ! f.isNumber() {
 				return errutil.New(ErrInvalidFieldDef,
 					errutil.MoreInfo, "cannot set " + kwFieldOptUnit,
 					"field", f.Name, "type", f.TypeString() )
@@ -183,254 +437,175 @@ func setFieldTypeAndOpts(f *fieldDef, optStr string, keyField bool) error {
 	return nil
 }
 
-func BuildFields(fNames, fOptStrs []string) ([]*fieldDef, error) {
+// fieldColumn is a column of table, while building fields.
+type fieldColumn struct {
+	// original field name and its index
+	name  string
+	index int
+	elems []fieldNameElem
+	// field def of the last element, with type and opts
+	f     *fieldDef
+}
+
+// BuildFields builds fields from the names and opts of columns.
+// the first column is the key field, unless the table has composite key,
+// whose fields are checked by the table.
+func BuildFields(fNames, fOptStrs []string, compositeKey bool) ([]*fieldDef, error) {
 	if len(fNames) == 0 || len(fNames) != len(fOptStrs) {
 		return nil, errutil.New(ErrInvalidFieldDef,
 			"len_names", strconv.Itoa(len(fNames)),
 			"len_opts", strconv.Itoa(len(fOptStrs)) )
 	}
 
-	// parse field names for subtypes & arrays
-	var err error
-	var mainName, subName string
-	arrayIndex := -1
-	var lastMainField *fieldDef
-	lastArrayIndex := -1
-	lastSubIndex := -1
-	mainFields := []*fieldDef{}
-	names := map[string]bool{}
-	subNames := map[string]bool{}
-	var i int
-	var name string
-	addMainField := func () error {
-		// check the subs ends ok
-		if lastArrayIndex >= 1 {
-			if lastSubIndex+1 != len(lastMainField.Subs) {
-				return errutil.New(ErrInvalidFieldDef,
-					errutil.MoreInfo, "field sub length mismatch",
-					"prev_subs_length", strconv.Itoa(len(lastMainField.Subs)),
-					"current_sub_length", strconv.Itoa(lastSubIndex+1),
-					"array_index", strconv.Itoa(lastArrayIndex),
-					"field", name, "field_index", strconv.Itoa(i) )
-			}
-		}
-		lastMainField.ArrayLen = lastArrayIndex + 1
-
-		// check and add last main field
-		_, exists := names[lastMainField.Name]
-		if exists {
-			return errutil.New(ErrDuplicateFieldNames,
-				"field", name, "field_index", strconv.Itoa(i))
-		}
-		names[lastMainField.Name] = true
-		mainFields = append(mainFields, lastMainField)
-		return nil
-	}
-	for i, name = range fNames {
+	cols := make([]*fieldColumn, len(fNames))
+	for i, name := range fNames {
 		// parse field name
-		mainName, arrayIndex, subName = DecomposeFieldName(name)
-		if len(mainName) == 0 {
+		elems := DecomposeFieldName(name)
+		if elems == nil {
 			return nil, errutil.New(ErrInvalidFieldDef,
 				errutil.MoreInfo, "invalid field name",
 				"field", name, "field_index", strconv.Itoa(i))
 		}
+		last := elems[len(elems)-1]
 
 		// build field
-		var f *fieldDef
-		if len(subName) > 0 {
-			f = &fieldDef{ Name: subName }
-		} else {
-			f = &fieldDef{ Name: mainName }
-		}
-		err = setFieldTypeAndOpts(f, fOptStrs[i], i==0)
+		f := &fieldDef{ Name: last.Name }
+		err := setFieldTypeAndOpts(f, fOptStrs[i], i==0 && ! compositeKey)
 		if err != nil {
 			return nil, errutil.AddInfo(err, "field", name)
 		}
-
-		// process first field == key field
-		if i == 0 {
-			if arrayIndex >= 0 {
-				return nil, errutil.New(ErrInvalidFieldDef,
-					errutil.MoreInfo, "key field cannot be array",
-					"field", name, "field_index", strconv.Itoa(i))
-			}
-			if len(subName) > 0 {
-				return nil, errutil.New(ErrInvalidFieldDef,
-					errutil.MoreInfo, "key field cannot have subfield",
-					"sub_name", subName,
-					"field", name, "field_index", strconv.Itoa(i))
-			}
-
-			lastMainField = f
-			continue
+		if f.List && last.Index >= 0 {
+			return nil, errutil.New(ErrInvalidFieldDef,
+				errutil.MoreInfo, "array cannot be " + kwFieldOptList,
+				"field", name, "field_index", strconv.Itoa(i))
+		}
+		if f.Optional && last.Index >= 0 {
+			return nil, errutil.New(ErrInvalidFieldDef,
+				errutil.MoreInfo, "array cannot be " + kwFieldOptOptional,
+				"field", name, "field_index", strconv.Itoa(i))
 		}
+		if f.Type == vtMap && last.Index >= 0 {
+			return nil, errutil.New(ErrInvalidFieldDef,
+				errutil.MoreInfo, "array cannot be " + kwFieldTypeMap,
+				"field", name, "field_index", strconv.Itoa(i))
+		}
+		cols[i] = &fieldColumn{ name: name, index: i, elems: elems, f: f }
+	}
 
-		// from the second field on
+	// first field == key field
+	if ! compositeKey && cols[0].elems[0].Index >= 0 {
+		return nil, errutil.New(ErrInvalidFieldDef,
+			errutil.MoreInfo, "key field cannot be array",
+			"field", fNames[0], "field_index", "0")
+	}
+	if ! compositeKey && len(cols[0].elems) > 1 {
+		return nil, errutil.New(ErrInvalidFieldDef,
+			errutil.MoreInfo, "key field cannot have subfield",
+			"field", fNames[0], "field_index", "0")
+	}
 
-		if mainName != lastMainField.Name {
-			// change of main field
+	return buildFields(cols, 0)
+}
 
-			// check and add
-			err = addMainField()
-			if err != nil {
-				return nil, err
-			}
-			// start new main field
-			if arrayIndex >= 1 {
-				return nil, errutil.New(ErrInvalidFieldDef,
-					errutil.MoreInfo, "array index error",
-					"array_index", strconv.Itoa(arrayIndex),
-					"field", name, "field_index", strconv.Itoa(i))
-			}
-			subNames = map[string]bool{}
-			if len(subName) > 0 {
-				lastMainField = &fieldDef{ Name: mainName }
-				lastArrayIndex = arrayIndex
-				lastMainField.Subs = []*fieldDef{ f }
-				lastSubIndex = 0
-				subNames[f.Name] = true
-			} else {
-				lastMainField = f
-				lastArrayIndex = arrayIndex
-				lastSubIndex = -1
-			}
-			continue
+// buildFields builds fields from the depth-th elements of the names of cols.
+// cols of the same field must be adjacent.
+func buildFields(cols []*fieldColumn, depth int) ([]*fieldDef, error) {
+	fields := []*fieldDef{}
+	names := map[string]bool{}
+	for start := 0; start < len(cols); {
+		name := cols[start].elems[depth].Name
+		end := start + 1
+		for end < len(cols) && cols[end].elems[depth].Name == name {
+			end++
 		}
+		if names[name] {
+			return nil, errutil.New(ErrDuplicateFieldNames,
+				"field", cols[start].name,
+				"field_index", strconv.Itoa(cols[start].index))
+		}
+		names[name] = true
 
-		// continue in the same main field
+		f, err := buildField(cols[start:end], depth)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, f)
+		start = end
+	}
+	return fields, nil
+}
 
-		// check array index
-		if ( lastArrayIndex == -1 && arrayIndex != -1 ) ||
-			( lastArrayIndex >= 0 &&
-				( arrayIndex != lastArrayIndex &&
-				arrayIndex != lastArrayIndex+1 ) ) {
-			var lindex, cindex string
-			if lastArrayIndex == -1 {
-				lindex = "none"
-			} else {
-				lindex = strconv.Itoa(lastArrayIndex)
-			}
-			if arrayIndex == -1 {
-				cindex = "none"
-			} else {
-				cindex = strconv.Itoa(arrayIndex)
-			}
+// buildField builds a field from cols, whose depth-th elements
+// have the same name.
+func buildField(cols []*fieldColumn, depth int) (*fieldDef, error) {
+	first := cols[0]
+	isArray := first.elems[depth].Index >= 0
+	hasSubs := len(first.elems) > depth+1
+	for _, c := range cols {
+		if (c.elems[depth].Index >= 0) != isArray {
 			return nil, errutil.New(ErrInvalidFieldDef,
 				errutil.MoreInfo, "field array index error",
-				"last_array_index", lindex,
-				"current_array_index", cindex,
-				"field", name, "field_index", strconv.Itoa(i))
+				"field", c.name, "field_index", strconv.Itoa(c.index))
 		}
-		// check sub
-		if ( lastSubIndex == -1 && len(subName) > 0 ) ||
-			( lastSubIndex != -1 && len(subName) == 0 ) {
+		if (len(c.elems) > depth+1) != hasSubs {
 			return nil, errutil.New(ErrInvalidFieldDef,
 				errutil.MoreInfo, "field sub error",
-				"field", name, "field_index", strconv.Itoa(i))
+				"field", c.name, "field_index", strconv.Itoa(c.index))
 		}
+	}
 
-		if len(subName) == 0 {
-			// no sub. so must be continuing array
-			if lastArrayIndex == -1 {
-				// other errors were filtered above.
-				// so must be the same field again
-				if lastMainField.Name == f.Name {
-					return nil, errutil.New(ErrDuplicateFieldNames,
-						"field", name, "field_index", strconv.Itoa(i))
-				} else {
-					return nil, errutil.NewAssert(
-						"field", name, "field_index", strconv.Itoa(i))
-				}
-			} else if arrayIndex != lastArrayIndex+1 {
-				// other errors were filtered above.
-				// so must be the same field, same array index again
+	// split cols into array elements
+	elemCols := [][]*fieldColumn{}
+	if isArray {
+		for start := 0; start < len(cols); {
+			index := cols[start].elems[depth].Index
+			if index != len(elemCols) {
 				return nil, errutil.New(ErrInvalidFieldDef,
 					errutil.MoreInfo, "field array index error",
-					"last_array_index", strconv.Itoa(lastArrayIndex),
-					"current_array_index", strconv.Itoa(arrayIndex),
-					"field", name, "field_index", strconv.Itoa(i))
+					"expected_array_index", strconv.Itoa(len(elemCols)),
+					"array_index", strconv.Itoa(index),
+					"field", cols[start].name,
+					"field_index", strconv.Itoa(cols[start].index))
 			}
-			// compare fields
-			if ! f.Opts.Equals(lastMainField.Opts) {
-				return nil, errutil.New(ErrInvalidFieldDef,
-					errutil.MoreInfo, "every field in array must be the same",
-					"field", name, "field_index", strconv.Itoa(i))
-			}
-			lastArrayIndex = arrayIndex
-		} else if lastArrayIndex == -1 {
-			// has sub and no array
-			_, exists := subNames[f.Name]
-			if exists {
-				return nil, errutil.New(ErrInvalidFieldDef,
-					errutil.MoreInfo, "duplicate sub names",
-					"main_name", lastMainField.Name, "sub_name", f.Name,
-					"field", name, "field_index", strconv.Itoa(i))
+			end := start + 1
+			for end < len(cols) && cols[end].elems[depth].Index == index {
+				end++
 			}
-			subNames[f.Name] = true
-			lastMainField.Subs = append(lastMainField.Subs, f)
-			lastSubIndex++
-		} else {
-			// has sub and array
-			if arrayIndex == lastArrayIndex {
-				// same array index
-				// if first, add sub
-				if lastArrayIndex == 0 {
-					_, exists := subNames[f.Name]
-					if exists {
-						return nil, errutil.New(ErrInvalidFieldDef,
-							errutil.MoreInfo, "duplicate sub names",
-							"main_name", lastMainField.Name, "sub_name", f.Name,
-							"field", name, "field_index", strconv.Itoa(i))
-					}
-					subNames[f.Name] = true
-					lastMainField.Subs = append(lastMainField.Subs, f)
-					lastSubIndex++
-					continue
-				}
-				// otherwise flow down
-
-				lastSubIndex++
-			} else {
-				// arrayIndex == lastArrayIndex+1, by the above check
-				// reset flow subindex and flow down
-				lastSubIndex = 0
-			}
-			// other cases were filtered above.
+			elemCols = append(elemCols, cols[start:end])
+			start = end
+		}
+	} else {
+		elemCols = append(elemCols, cols)
+	}
 
-			// compare with prev sub field
-			if lastSubIndex+1 > len(lastMainField.Subs) {
-				return nil, errutil.New(ErrInvalidFieldDef,
-					errutil.MoreInfo, "field sub mismatch. length too long",
-					"array_index", strconv.Itoa(arrayIndex),
-					"field", name, "field_index", strconv.Itoa(i))
-			}
-			prev := lastMainField.Subs[lastSubIndex]
-			if f.Name != prev.Name {
-				return nil, errutil.New(ErrInvalidFieldDef,
-					errutil.MoreInfo, "field sub mismatch",
-					"prev_name", prev.Name, "current_name", f.Name,
-					"sub_index", strconv.Itoa(lastSubIndex),
-					"array_index", strconv.Itoa(arrayIndex),
-					"field", name, "field_index", strconv.Itoa(i))
+	var f *fieldDef
+	for k, ec := range elemCols {
+		var ef *fieldDef
+		if hasSubs {
+			subs, err := buildFields(ec, depth+1)
+			if err != nil {
+				return nil, err
 			}
-			if ! f.Opts.Equals(prev.Opts) {
-				return nil, errutil.New(ErrInvalidFieldDef,
-					errutil.MoreInfo, "field sub mismatch. options differ.",
-					"subname", f.Name,
-					"array_index", strconv.Itoa(arrayIndex),
-					"field", name, "field_index", strconv.Itoa(i))
+			ef = &fieldDef{ Name: first.elems[depth].Name, Subs: subs }
+		} else {
+			if len(ec) > 1 {
+				return nil, errutil.New(ErrDuplicateFieldNames,
+					"field", ec[1].name, "field_index", strconv.Itoa(ec[1].index))
 			}
-
-			lastArrayIndex = arrayIndex
+			ef = ec[0].f
+		}
+		if k == 0 {
+			f = ef
+		} else if ! ef.Equals(f) {
+			return nil, errutil.New(ErrInvalidFieldDef,
+				errutil.MoreInfo, "every field in array must be the same",
+				"field", ec[0].name, "field_index", strconv.Itoa(ec[0].index))
 		}
 	}
-	// check and add the last main field
-	err = addMainField()
-	if err != nil {
-		return nil, err
+	if isArray {
+		f.ArrayLen = len(elemCols)
 	}
-
-	return mainFields, nil
+	return f, nil
 }
 
 func FieldTypeSymbolName(tableName string) string {
@@ -438,13 +613,10 @@ func FieldTypeSymbolName(tableName string) string {
 }
 const syFieldPrefix = "_field."
 
-func FieldSymbolName(tableName, fieldName, subfieldName string) string {
-	if len(subfieldName) == 0 {
-		return FieldTypeSymbolName(tableName) + "." + fieldName
-	} else {
-		return FieldTypeSymbolName(tableName) + "." + fieldName +
-			"." + subfieldName
-	}
+// FieldSymbolName returns the symbol name of the field, given
+// the names of the field and its parents, from the top.
+func FieldSymbolName(tableName string, fieldPath ...string) string {
+	return FieldTypeSymbolName(tableName) + "." + strings.Join(fieldPath, ".")
 }
 
 type fieldDef struct {
@@ -459,11 +631,39 @@ type fieldDef struct {
 	CoverAll bool
 	Units    map[string]int
 	MinStr, MaxStr string
+	// encoded as sint32 or sint64
+	ZigZag   bool
+	// repeated values in a single cell
+	List     bool
+	// number of elements for list, or number of characters for string
+	MinLen, MaxLen int
+	// regexp which string values must match as a whole
+	Pattern  string
+	NonEmpty bool
+	// values must be unique within the table, except empty cells
+	Unique   bool
+	// table of which keys the values must be. key of the table is int.
+	Ref      string
+	// value used if the cell is empty
+	DefaultStr string
+	// omitted if the cell is empty
+	Optional bool
+	// key and value of map
+	MapKey, MapValue *fieldDef
+	// const group of enum, if enum values are given by consts
+	EnumGroup string
+	// enum names and values. for const group, set when resolved
+	EnumNames  []string
+	EnumValues []int
 
 	// when resolved
 
 	*symbolInfo
 	Min, Max int
+	// min and max of float and double fields
+	MinFloat, MaxFloat float64
+	// compiled Pattern
+	rePattern *regexp.Regexp
 
 	ProtoKey uint64
 }
@@ -503,6 +703,195 @@ func (f *fieldDef) TypeString() string {
 	return typeString(f.Type)
 }
 
+// isNumber reports whether the field can have min, max and units.
+func (f *fieldDef) isNumber() bool {
+	return f.isInt() || f.isFloat()
+}
+
+// isInt reports whether the field value is resolved by resolveInt.
+func (f *fieldDef) isInt() bool {
+	switch f.Type {
+	case vtInt, vtFixed4, vtInt64, vtUint32, vtUint64:
+		return true
+	default:
+		return false
+	}
+}
+
+// setMap sets key and value of map field, declared as $map=keytype,valuetype.
+// $keysof is for the key, whose type must be id, and the other opts are
+// for the value. value of type enum takes names from $enum.
+func (f *fieldDef) setMap(keyField bool) error {
+	if keyField {
+		return errutil.New(ErrInvalidFieldDef,
+			errutil.MoreInfo, "key field cannot be " + kwFieldTypeMap,
+			"field", f.Name)
+	}
+	types := f.Opts.MultiValued[kwFieldTypeMap]
+	if len(types) != 2 {
+		return errutil.New(ErrInvalidFieldDef,
+			errutil.MoreInfo, kwFieldTypeMap + " must have key and value types",
+			"field", f.Name, "values", strings.Join(types, " "))
+	}
+	kt, vt := types[0], types[1]
+
+	keyOpts := newOptions()
+	keysOf, hasKeysOf := f.Opts.MultiValued[kwFieldTypeKeysOf]
+	if kt == typeString(vtId) {
+		if ! hasKeysOf {
+			return errutil.New(ErrInvalidFieldDef,
+				errutil.MoreInfo, "key of type id needs " + kwFieldTypeKeysOf,
+				"field", f.Name)
+		}
+		keyOpts.MultiValued[kwFieldTypeKeysOf] = keysOf
+		// $coverall of map is for the keys
+		if f.Opts.WithoutValue[kwFieldOptCoverAll] {
+			keyOpts.WithoutValue[kwFieldOptCoverAll] = true
+		}
+	} else if ! mapKeyTypes[kt] {
+		return errutil.New(ErrInvalidFieldDef,
+			errutil.MoreInfo, "invalid key type of " + kwFieldTypeMap,
+			"field", f.Name, "key_type", kt)
+	} else if hasKeysOf {
+		return errutil.New(ErrInvalidFieldDef,
+			errutil.MoreInfo, "cannot set " + kwFieldTypeKeysOf,
+			"field", f.Name, "key_type", kt)
+	} else {
+		keyOpts.WithoutValue[string(kwMarker) + kt] = true
+	}
+
+	valueOpts := newOptions()
+	if ! mapValueTypes[vt] {
+		return errutil.New(ErrInvalidFieldDef,
+			errutil.MoreInfo, "invalid value type of " + kwFieldTypeMap,
+			"field", f.Name, "value_type", vt)
+	}
+	if vt != typeString(vtEnum) {
+		valueOpts.WithoutValue[string(kwMarker) + vt] = true
+	}
+	for k, _ := range f.Opts.WithoutValue {
+		if k != kwFieldOptCoverAll || kt != typeString(vtId) {
+			valueOpts.WithoutValue[k] = true
+		}
+	}
+	for k, v := range f.Opts.SingleValued {
+		valueOpts.SingleValued[k] = v
+	}
+	for k, v := range f.Opts.MultiValued {
+		if k != kwFieldTypeMap && k != kwFieldTypeKeysOf {
+			valueOpts.MultiValued[k] = v
+		}
+	}
+
+	// value is named after the field, for the name of enum type
+	f.MapKey = &fieldDef{ Name: f.Name + ".key" }
+	err := f.MapKey.setTypeAndOpts(keyOpts, false)
+	if err != nil {
+		return errutil.AddInfo(err, "field", f.Name)
+	}
+	f.MapValue = &fieldDef{ Name: f.Name }
+	err = f.MapValue.setTypeAndOpts(valueOpts, false)
+	if err != nil {
+		return errutil.AddInfo(err, "field", f.Name)
+	}
+	if f.MapValue.List {
+		return errutil.New(ErrInvalidFieldDef,
+			errutil.MoreInfo, "value of " + kwFieldTypeMap + " cannot be " + kwFieldOptList,
+			"field", f.Name)
+	}
+	if f.MapValue.Unique {
+		return errutil.New(ErrInvalidFieldDef,
+			errutil.MoreInfo, "cannot set " + kwFieldOptUnique + " for " + kwFieldTypeMap,
+			"field", f.Name)
+	}
+	// $default is for empty values of entries
+	if f.MapValue.Optional {
+		return errutil.New(ErrInvalidFieldDef,
+			errutil.MoreInfo, "cannot set " + kwFieldOptOptional + " for " + kwFieldTypeMap,
+			"field", f.Name)
+	}
+	f.Type = vtMap
+	return nil
+}
+
+var mapKeyTypes = map[string]bool{
+	"int": true, "int64": true, "uint32": true, "uint64": true,
+	"bool": true, "string": true,
+}
+var mapValueTypes = map[string]bool{
+	"int": true, "fixed4": true, "int64": true, "uint32": true, "uint64": true,
+	"bool": true, "string": true, "float": true, "double": true, "enum": true,
+	"duration": true, "datetime": true,
+}
+
+// setEnum sets enum names and values from the values of $enum.
+// a single value is the name of const group, i.e. consts named
+// Group_Name, and is resolved later when consts are known. it is an
+// error if there's no const in the group.
+// otherwise values are names, numbered from 0 in the given order,
+// so new names must be appended to keep the numbers.
+func (f *fieldDef) setEnum(v []string) error {
+	if len(v) == 0 {
+		return errutil.New(ErrInvalidFieldDef,
+			errutil.MoreInfo, "no value is specified for type " + kwFieldTypeEnum,
+			"field", f.Name)
+	}
+	if len(v) == 1 {
+		err := CheckValidUserDefinedSymbol(v[0])
+		if err != nil {
+			return errutil.Embed(ErrInvalidFieldDef, err,
+				errutil.MoreInfo, "invalid const group for " + kwFieldTypeEnum,
+				"field", f.Name)
+		}
+		f.EnumGroup = v[0]
+		return nil
+	}
+	names := map[string]bool{}
+	for i, name := range v {
+		err := CheckValidUserDefinedSymbol(name)
+		if err != nil {
+			return errutil.Embed(ErrInvalidFieldDef, err,
+				errutil.MoreInfo, "invalid name for " + kwFieldTypeEnum,
+				"field", f.Name)
+		}
+		if names[name] {
+			return errutil.New(ErrInvalidFieldDef,
+				errutil.MoreInfo, "duplicate name for " + kwFieldTypeEnum,
+				"field", f.Name, "name", name)
+		}
+		names[name] = true
+		f.EnumNames = append(f.EnumNames, name)
+		f.EnumValues = append(f.EnumValues, i)
+	}
+	return nil
+}
+
+// isSigned reports whether the field can be zigzag encoded.
+func (f *fieldDef) isSigned() bool {
+	return f.Type == vtInt || f.Type == vtFixed4 || f.Type == vtInt64
+}
+
+// isTime reports whether the field is duration or datetime,
+// which is kept as int of milliseconds.
+func (f *fieldDef) isTime() bool {
+	return f.Type == vtDuration || f.Type == vtDatetime
+}
+
+// compilePattern compiles pattern p, which must match the whole value.
+func compilePattern(p string) (*regexp.Regexp, error) {
+	return regexp.Compile(`^(?:` + p + `)$`)
+}
+
+// isString reports whether the field value is a string,
+// which can have pattern and length constraints.
+func (f *fieldDef) isString() bool {
+	return f.Type == vtString || f.Type == vtText
+}
+
+func (f *fieldDef) isFloat() bool {
+	return f.Type == vtFloat || f.Type == vtDouble
+}
+
 func (f *fieldDef) ProtoSubType() string {
 	if len(f.Subs) > 0 {
 		return pfxSubType + f.Name
@@ -512,25 +901,113 @@ func (f *fieldDef) ProtoSubType() string {
 	}
 }
 
+// ProtoEnumType returns the name of enum type nested in the message.
+func (f *fieldDef) ProtoEnumType() string {
+	return pfxEnumType + f.Name
+}
+
+// ProtoEnum returns the definition of enum type of the field,
+// or empty string if the field is not enum.
+// enum value names are prefixed by the field name,
+// since they share the scope of the message.
+func (f *fieldDef) ProtoEnum(indent string) string {
+	if f.Type == vtMap {
+		return f.MapValue.ProtoEnum(indent)
+	}
+	if f.Type != vtEnum {
+		return ""
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%senum %s {\n", indent, f.ProtoEnumType())
+	values := map[int]bool{}
+	for _, v := range f.EnumValues {
+		if values[v] {
+			fmt.Fprintf(&b, "%s    option allow_alias = true;\n", indent)
+			break
+		}
+		values[v] = true
+	}
+	// proto3 enum must start with 0
+	if ! values[0] {
+		fmt.Fprintf(&b, "%s    %s_%s = 0;\n", indent, f.Name, enumUnspecified)
+	}
+	for i, name := range f.EnumNames {
+		fmt.Fprintf(&b, "%s    %s_%s = %d;\n",
+			indent, f.Name, name, f.EnumValues[i])
+	}
+	fmt.Fprintf(&b, "%s}\n", indent)
+	return b.String()
+}
+
+const enumUnspecified = "UNSPECIFIED"
+
 func (f *fieldDef) ProtoType() string {
 	if len(f.Subs) > 0 {
 		return f.ProtoSubType()
+	} else if f.Type == vtMap {
+		return fmt.Sprintf("map<%s, %s>",
+			f.MapKey.ProtoType(), f.MapValue.ProtoType())
+	} else if f.Type == vtEnum {
+		return f.ProtoEnumType()
+	} else if f.ZigZag && f.Type == vtInt64 {
+		return "sint64"
+	} else if f.ZigZag {
+		return "sint32"
 	} else if f.Type == vtInt || f.Type == vtFixed4 || f.Type == vtId {
 		return "int32"
-	} else if f.Type == vtString {
+	} else if f.Type == vtString || f.Type == vtText {
+		// text is the key of localized text
 		return "string"
+	} else if f.Type == vtBool {
+		return "bool"
+	} else if f.Type == vtInt64 || f.Type == vtUint32 || f.Type == vtUint64 {
+		return f.TypeString()
+	} else if f.Type == vtDuration {
+		return "google.protobuf.Duration"
+	} else if f.Type == vtDatetime {
+		return "google.protobuf.Timestamp"
+	} else if f.Type == vtFloat {
+		return "float"
+	} else if f.Type == vtDouble {
+		return "double"
 	} else {
 		return fmt.Sprintf("ERROR: UNKNOWN TYPE name: %v type: %v",
 			f.Name, f.Type)
 	}
 }
 
+// ProtoDef returns the definitions of the field in proto message,
+// i.e. message type of subs, enum type and the field itself.
+func (f *fieldDef) ProtoDef(indent string) (string, error) {
+	var b strings.Builder
+	if len(f.Subs) > 0 {
+		fmt.Fprintf(&b, "%smessage %s {\n", indent, f.ProtoSubType())
+		for _, sub := range f.Subs {
+			def, err := sub.ProtoDef(indent + "    ")
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(def)
+		}
+		fmt.Fprintf(&b, "%s}\n", indent)
+	}
+	b.WriteString(f.ProtoEnum(indent))
+	line, err := f.ProtoLine()
+	if err != nil {
+		return "", err
+	}
+	b.WriteString(indent + line)
+	return b.String(), nil
+}
+
 func (f *fieldDef) ProtoLine() (string, error) {
 	typ := f.ProtoType()
 	var repeated, packOpt string
-	if f.ArrayLen > 0 {
+	if f.Optional {
+		repeated = "optional "
+	} else if f.repeated() {
 		repeated = "repeated "
-		if f.Type == vtInt || f.Type == vtFixed4 || f.Type == vtId {
+		if len(f.Subs) == 0 && f.wireType() != proto.WireBytes {
 			packOpt = " [packed=true]"
 		}
 	}
@@ -547,32 +1024,85 @@ func (f *fieldDef) SetProtoKey() error {
 	tag := f.symbolInfo.Value
 	if len(f.Subs) > 0 {
 		f.ProtoKey = uint64(tag) << 3 | proto.WireBytes
-	} else if f.Type == vtId || f.Type == vtInt || f.Type == vtFixed4 {
-		f.ProtoKey = uint64(tag) << 3 | proto.WireVarint
-	} else if f.Type == vtString {
+		return nil
+	}
+	if f.Type == vtMap {
+		// each entry is a message of key = 1 and value = 2
 		f.ProtoKey = uint64(tag) << 3 | proto.WireBytes
-	} else {
+		f.MapKey.symbolInfo = &symbolInfo{ Value: 1 }
+		f.MapValue.symbolInfo = &symbolInfo{ Value: 2 }
+		err := f.MapKey.SetProtoKey()
+		if err != nil {
+			return err
+		}
+		return f.MapValue.SetProtoKey()
+	}
+	wt := f.wireType()
+	if wt < 0 {
 		return errutil.NewAssert(
 			errutil.MoreInfo, "invalid type",
 			"field", f.Name, "type", f.TypeString() )
 	}
+	if f.repeated() {
+		// packed
+		wt = proto.WireBytes
+	}
+	f.ProtoKey = uint64(tag) << 3 | uint64(wt)
 
 	return nil
 }
 
+// rawValue returns v, or the default value if v is empty.
+func (f *fieldDef) rawValue(v string) string {
+	if len(v) == 0 {
+		return f.DefaultStr
+	}
+	return v
+}
+
+// repeated reports whether the field is repeated in proto,
+// i.e. array or list.
+func (f *fieldDef) repeated() bool {
+	return f.ArrayLen > 0 || f.List
+}
+
+// wireType returns the wire type of a single value of the field,
+// or -1 if the type is not valid.
+func (f *fieldDef) wireType() int {
+	switch f.Type {
+	case vtId, vtInt, vtFixed4, vtBool, vtInt64, vtUint32, vtUint64, vtEnum:
+		return proto.WireVarint
+	case vtString, vtText, vtDuration, vtDatetime:
+		return proto.WireBytes
+	case vtFloat:
+		return proto.WireFixed32
+	case vtDouble:
+		return proto.WireFixed64
+	default:
+		return -1
+	}
+}
+
 /////////////////////////////////////////////////////////////////////
 
 func init() {
 	ErrInvalidFieldDef = errors.New("필드 정의가 잘못됨")
 
 	reFieldName, _ = regexp.Compile(
-		`^([A-Za-z][_A-Za-z0-9]*)(\[(\d+)\])?(\.([A-Za-z][_A-Za-z0-9]*))?$`)
+		`^([A-Za-z][_A-Za-z0-9]*)(\[(\d+)\])?$`)
 
 	fieldOpts1 = []string{
 		kwFieldTypeAutoKey, kwFieldTypeInt, kwFieldTypeFixed4, kwFieldTypeString,
-		kwFieldOptCoverAll }
-	fieldOpts2 = []string{ kwFieldOptMin, kwFieldOptMax }
-	fieldOpts3 = []string{ kwFieldTypeKeysOf, kwFieldOptUnit }
+		kwFieldTypeBool, kwFieldTypeFloat, kwFieldTypeDouble,
+		kwFieldTypeInt64, kwFieldTypeUint32, kwFieldTypeUint64,
+		kwFieldTypeDuration, kwFieldTypeDatetime, kwFieldTypeText,
+		kwFieldOptCoverAll, kwFieldOptZigZag, kwFieldOptList, kwFieldOptOptional,
+		kwFieldOptNonEmpty, kwFieldOptUnique }
+	fieldOpts2 = []string{ kwFieldOptMin, kwFieldOptMax,
+		kwFieldOptMinLen, kwFieldOptMaxLen, kwFieldOptDefault, kwFieldOptPattern,
+		kwFieldOptRef }
+	fieldOpts3 = []string{ kwFieldTypeKeysOf, kwFieldTypeEnum, kwFieldTypeMap,
+		kwFieldOptUnit }
 }
 
 var reFieldName *regexp.Regexp
@@ -0,0 +1,43 @@
+package nparamcli
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSetFieldTypeAndOpts(t *testing.T) {
+	tests := []struct {
+		optStr   string
+		keyField bool
+		err      error
+	}{
+		{ "$int;$optional", false, nil },
+		{ "$int;$default=3", false, nil },
+		{ "$int;$optional;$default=3", false, ErrInvalidFieldDef },
+		{ `$int;$default=""`, false, ErrInvalidFieldDef },
+		{ "$int;$optional", true, ErrInvalidFieldDef },
+		{ "$int;$default=3", true, ErrInvalidFieldDef },
+		{ "$int;$list;$optional", false, ErrInvalidFieldDef },
+		{ "$string;$optional;$nonempty", false, ErrInvalidFieldDef },
+		{ "$string;$pattern=[a-z]+;$minlen=1;$maxlen=8", false, nil },
+		{ "$string;$pattern=[a-", false, ErrInvalidFieldDef },
+		{ "$string;$minlen=3;$maxlen=2", false, ErrInvalidFieldDef },
+		{ "$int;$pattern=[0-9]", false, ErrInvalidFieldDef },
+		{ "$int;$nonempty", false, ErrInvalidFieldDef },
+		{ "$int;$maxlen=2", false, ErrInvalidFieldDef },
+	}
+	for _, tt := range tests {
+		f := &fieldDef{ Name: "f" }
+		err := setFieldTypeAndOpts(f, tt.optStr, tt.keyField)
+		if tt.err == nil {
+			if err != nil {
+				t.Errorf("%q: %v", tt.optStr, err)
+			}
+			continue
+		}
+		if err == nil || ! strings.Contains(err.Error(), tt.err.Error()) {
+			t.Errorf("%q key %v: error %v, want %v",
+				tt.optStr, tt.keyField, err, tt.err)
+		}
+	}
+}
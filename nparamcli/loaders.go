@@ -0,0 +1,275 @@
+package nparamcli
+
+// loaders have lookup helpers of tables with composite key, i.e.
+// table option $keys. for each table, key type of the values of key
+// fields, the key of a row, and lookup by keys are generated, on top of
+// the types generated by protoc.
+
+import (
+	"os"
+	"sort"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/bluegol/errutil"
+)
+
+// compositeKeyTables returns tables with composite key, sorted by name.
+func (proc *processor) compositeKeyTables() []*tableMeta {
+	tNames := []string{}
+	for tName, tm := range proc.tms {
+		if len(tm.KeyFields) > 0 {
+			tNames = append(tNames, tName)
+		}
+	}
+	sort.Strings(tNames)
+	result := make([]*tableMeta, len(tNames))
+	for k, tName := range tNames {
+		result[k] = proc.tms[tName]
+	}
+	return result
+}
+
+// writeLoader writes loader file fn with tmplStr. name converts names of
+// proto to those of the language, and param converts field names to
+// names of parameters. if no table has composite key, fn is not written,
+// and the previous one is removed.
+func (proc *processor) writeLoader(
+	fn, tmplStr string, name, param func(string) string) error {
+
+	tms := proc.compositeKeyTables()
+	if len(tms) == 0 {
+		err := os.Remove(fn)
+		if err != nil && ! os.IsNotExist(err) {
+			return errutil.AssertEmbed(err, "file", fn)
+		}
+		proc.logger.Info("no table with composite key", "file", fn)
+		return nil
+	}
+
+	tmpl := template.Must(
+		template.New("loader").
+		Funcs(template.FuncMap{
+			"protoPackage": func() string {
+				return proc.config.ProtoPackage
+			},
+			"protoTypePrefix" : func() string {
+				return proc.config.ProtoTypePrefix
+			},
+			"name": name,
+			"param": param,
+		}).
+		Parse(tmplStr))
+
+	err := ExecuteTemplateToFile(fn, tmpl, tms)
+	if err != nil {
+		return err
+	}
+	proc.logger.Info("generated loader src file", "file", fn)
+	return nil
+}
+
+// goName returns the name of go type or field generated by protoc for
+// proto name s, as CamelCase of protoc-gen-go. _ followed by a lower
+// case letter is removed, and a lower case letter is capitalized if it
+// doesn't follow another lower case letter.
+func goName(s string) string {
+	var b strings.Builder
+	i := 0
+	if len(s) > 0 && s[0] == '_' {
+		b.WriteByte('X')
+		i++
+	}
+	for ; i < len(s); i++ {
+		c := s[i]
+		if c == '_' && i+1 < len(s) && isLowerByte(s[i+1]) {
+			continue
+		}
+		if isDigitByte(c) {
+			b.WriteByte(c)
+			continue
+		}
+		if isLowerByte(c) {
+			c -= 'a' - 'A'
+		}
+		b.WriteByte(c)
+		for i+1 < len(s) && isLowerByte(s[i+1]) {
+			i++
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// goParam returns the name of go parameter for field name s.
+func goParam(s string) string {
+	p := []rune(goName(s))
+	p[0] = unicode.ToLower(p[0])
+	result := string(p)
+	if goKeywords[result] || result == "d" || result == "m" {
+		result += "_"
+	}
+	return result
+}
+
+// csName returns the name of c# property generated by protoc for
+// field name s. _ is removed and the next letter is capitalized, as well
+// as the first letter and letters after digits.
+func csName(s string) string {
+	var b strings.Builder
+	upper := true
+	for _, c := range s {
+		if c == '_' {
+			upper = true
+			continue
+		}
+		if upper {
+			c = unicode.ToUpper(c)
+		}
+		upper = unicode.IsDigit(c)
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// csParam returns the name of c# parameter for field name s.
+// @ allows keywords.
+func csParam(s string) string {
+	p := []rune(csName(s))
+	p[0] = unicode.ToLower(p[0])
+	return "@" + string(p)
+}
+
+func isLowerByte(c byte) bool {
+	return 'a' <= c && c <= 'z'
+}
+
+func isDigitByte(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+var goKeywords = map[string]bool{
+	"break": true, "case": true, "chan": true, "const": true,
+	"continue": true, "default": true, "defer": true, "else": true,
+	"fallthrough": true, "for": true, "func": true, "go": true,
+	"goto": true, "if": true, "import": true, "interface": true,
+	"map": true, "package": true, "range": true, "return": true,
+	"select": true, "struct": true, "switch": true, "type": true,
+	"var": true,
+}
+
+const goLoaderTmplStr = `
+{{- "package"}} {{protoPackage}}
+{{ range . }}
+{{- $msg := name (print protoTypePrefix .Name) }}
+{{- $data := name (print "Data_" protoTypePrefix .Name) }}
+// {{$msg}}Key is the composite key of {{.Name}}.
+type {{$msg}}Key struct {
+{{- range .KeyFields }}
+	{{ name . }} int32
+{{- end }}
+}
+
+// CompositeKey returns the composite key of m.
+func (m *{{$msg}}) CompositeKey() {{$msg}}Key {
+	return {{$msg}}Key{
+		{{- range $i, $f := .KeyFields }}{{ if $i }}, {{ end }}int32(m.Get{{ name $f }}()){{ end -}}
+	}
+}
+
+// Index returns rows of d by their composite keys.
+func (d *{{$data}}) Index() map[{{$msg}}Key]*{{$msg}} {
+	index := make(map[{{$msg}}Key]*{{$msg}}, len(d.Data))
+	for _, m := range d.Data {
+		index[m.CompositeKey()] = m
+	}
+	return index
+}
+
+// Find returns the row of the keys, or nil if not found.
+// use Index for frequent lookups.
+func (d *{{$data}}) Find(
+	{{- range $i, $f := .KeyFields }}{{ if $i }}, {{ end }}{{ param $f }}{{ end }} int32) *{{$msg}} {
+	for _, m := range d.Data {
+		if m.CompositeKey() == ({{$msg}}Key{
+			{{- range $i, $f := .KeyFields }}{{ if $i }}, {{ end }}{{ param $f }}{{ end -}}
+		}) {
+			return m
+		}
+	}
+	return nil
+}
+{{ end }}`
+
+const csLoaderTmplStr = `
+{{- "namespace"}} {{protoPackage}} {
+{{- range . }}
+{{- $msg := print protoTypePrefix .Name }}
+
+	// composite key of {{.Name}}
+	public struct {{$msg}}Key : System.IEquatable<{{$msg}}Key> {
+	{{- range .KeyFields }}
+		public readonly int {{ name . }};
+	{{- end }}
+
+		public {{$msg}}Key(
+			{{- range $i, $f := .KeyFields }}{{ if $i }}, {{ end }}int {{ param $f }}{{ end -}}
+		) {
+		{{- range .KeyFields }}
+			{{ name . }} = {{ param . }};
+		{{- end }}
+		}
+
+		public bool Equals({{$msg}}Key other) {
+			return
+				{{- range $i, $f := .KeyFields }}{{ if $i }} &&{{ end }} {{ name $f }} == other.{{ name $f }}{{ end -}}
+			;
+		}
+
+		public override bool Equals(object obj) {
+			return obj is {{$msg}}Key && Equals(({{$msg}}Key)obj);
+		}
+
+		public override int GetHashCode() {
+			int hash = 17;
+		{{- range .KeyFields }}
+			hash = hash * 31 + {{ name . }};
+		{{- end }}
+			return hash;
+		}
+	}
+
+	public sealed partial class {{$msg}} {
+		public {{$msg}}Key CompositeKey {
+			get {
+				return new {{$msg}}Key(
+					{{- range $i, $f := .KeyFields }}{{ if $i }}, {{ end }}(int){{ name $f }}{{ end -}}
+				);
+			}
+		}
+	}
+
+	public sealed partial class Data_{{$msg}} {
+		private System.Collections.Generic.Dictionary<{{$msg}}Key, {{$msg}}> index;
+
+		// Find returns the row of the keys, or null if not found.
+		public {{$msg}} Find(
+			{{- range $i, $f := .KeyFields }}{{ if $i }}, {{ end }}int {{ param $f }}{{ end -}}
+		) {
+			if (index == null) {
+				index = new System.Collections.Generic.Dictionary<{{$msg}}Key, {{$msg}}>(Data.Count);
+				foreach (var row in Data) {
+					index[row.CompositeKey] = row;
+				}
+			}
+			{{$msg}} result;
+			index.TryGetValue(new {{$msg}}Key(
+				{{- range $i, $f := .KeyFields }}{{ if $i }}, {{ end }}{{ param $f }}{{ end -}}
+			), out result);
+			return result;
+		}
+	}
+{{- end }}
+}
+`
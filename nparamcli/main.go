@@ -10,7 +10,12 @@ func Process(rebuild, warn bool) error {
 }
 
 func process(configFilename string, rebuild, warn bool) error {
-	logger := log.New()
+	return processWithLogger(log.New(), configFilename, rebuild, warn)
+}
+
+func processWithLogger(logger log.Logger,
+	configFilename string, rebuild, warn bool) error {
+
 	logger.Info("nparam build starts.")
 
 	current, err := checkVer()
@@ -82,6 +87,12 @@ func process(configFilename string, rebuild, warn bool) error {
 		return err
 	}
 
+	err = proc.generateTexts()
+	if err != nil {
+		logger.Crit(err.Error())
+		return err
+	}
+
 	err = proc.writeProtos()
 	if err != nil {
 		logger.Crit(err.Error())
@@ -0,0 +1,284 @@
+package nparamcli
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/bluegol/errutil"
+)
+
+var ErrCannotReadOds error
+
+var reOdsDuration *regexp.Regexp
+
+const (
+	odsNsOffice = "urn:oasis:names:tc:opendocument:xmlns:office:1.0"
+	odsNsTable  = "urn:oasis:names:tc:opendocument:xmlns:table:1.0"
+	odsNsText   = "urn:oasis:names:tc:opendocument:xmlns:text:1.0"
+
+	odsContentFn = "content.xml"
+)
+
+// ParseOds reads OpenDocument spreadsheet, and extracts consts and tables
+// the same way as xlsx.
+func ParseOds(odsFn string) ([]*cdef, []*tableMeta, [][][]string, error) {
+	zr, err := zip.OpenReader(odsFn)
+	if err != nil {
+		return nil, nil, nil, errutil.Embed(ErrCannotReadOds, err, "file", odsFn)
+	}
+	defer zr.Close()
+
+	var content *zip.File
+	for _, f := range zr.File {
+		if f.Name == odsContentFn {
+			content = f
+			break
+		}
+	}
+	if content == nil {
+		return nil, nil, nil, errutil.New(ErrCannotReadOds,
+			errutil.MoreInfo, "no " + odsContentFn, "file", odsFn)
+	}
+	r, err := content.Open()
+	if err != nil {
+		return nil, nil, nil, errutil.Embed(ErrCannotReadOds, err, "file", odsFn)
+	}
+	defer r.Close()
+
+	wsNames, wsCells, err := readOdsContent(r)
+	if err != nil {
+		return nil, nil, nil, errutil.Embed(ErrCannotReadOds, err, "file", odsFn)
+	}
+
+	return extractSheets(odsFn, wsNames, wsCells)
+}
+
+// readOdsContent reads content.xml of ods file, and returns
+// names and cells of the sheets.
+// repeated rows and cells are expanded, except the trailing empty ones.
+func readOdsContent(r io.Reader) ([]string, [][][]string, error) {
+	wsNames := []string{}
+	wsCells := [][][]string{}
+
+	var cells [][]string
+	var row []string
+	// number of empty rows and cells not yet added
+	var emptyRows, emptyCells int
+	var rowRepeat, cellRepeat int
+	var cellValue string
+	var text []string
+	inTable, inRow, inCell, inText := false, false, false, false
+
+	dec := xml.NewDecoder(r)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, nil, err
+		}
+
+		switch t := tok.(type) {
+
+		case xml.StartElement:
+			if t.Name.Space == odsNsTable {
+				switch t.Name.Local {
+				case "table":
+					if inTable {
+						// nested table in a cell. skip.
+						err = dec.Skip()
+						if err != nil {
+							return nil, nil, err
+						}
+						continue
+					}
+					inTable = true
+					wsNames = append(wsNames, odsAttr(t, odsNsTable, "name"))
+					cells = [][]string{}
+					emptyRows = 0
+				case "table-row":
+					if ! inTable {
+						continue
+					}
+					inRow = true
+					rowRepeat = odsRepeat(t, "number-rows-repeated")
+					row = []string{}
+					emptyCells = 0
+				case "table-cell", "covered-table-cell":
+					if ! inRow {
+						continue
+					}
+					inCell = true
+					cellRepeat = odsRepeat(t, "number-columns-repeated")
+					cellValue = ""
+					text = nil
+					switch odsAttr(t, odsNsOffice, "value-type") {
+					case "float", "percentage", "currency":
+						cellValue = odsAttr(t, odsNsOffice, "value")
+					case "boolean":
+						cellValue = strings.ToUpper(
+							odsAttr(t, odsNsOffice, "boolean-value"))
+					case "date":
+						// ISO 8601, such as 2016-05-17 or 2016-05-17T10:00:00
+						cellValue = odsAttr(t, odsNsOffice, "date-value")
+					case "time":
+						// if not converted, displayed text is used
+						cellValue = odsDuration(
+							odsAttr(t, odsNsOffice, "time-value"))
+					}
+				}
+			} else if t.Name.Space == odsNsOffice &&
+				t.Name.Local == "annotation" {
+				// comment attached to the cell. skip.
+				err = dec.Skip()
+				if err != nil {
+					return nil, nil, err
+				}
+			} else if t.Name.Space == odsNsText && inCell {
+				switch t.Name.Local {
+				case "p", "h":
+					inText = true
+					text = append(text, "")
+				case "s":
+					if inText {
+						n := 1
+						c := odsAttr(t, odsNsText, "c")
+						if len(c) > 0 {
+							n, _ = strconv.Atoi(c)
+						}
+						text[len(text)-1] += strings.Repeat(" ", n)
+					}
+				case "tab":
+					if inText {
+						text[len(text)-1] += "\t"
+					}
+				case "line-break":
+					if inText {
+						text[len(text)-1] += "\n"
+					}
+				}
+			}
+
+		case xml.CharData:
+			if inText {
+				text[len(text)-1] += string(t)
+			}
+
+		case xml.EndElement:
+			if t.Name.Space == odsNsText {
+				if t.Name.Local == "p" || t.Name.Local == "h" {
+					inText = false
+				}
+				continue
+			}
+			if t.Name.Space != odsNsTable {
+				continue
+			}
+			switch t.Name.Local {
+			case "table-cell", "covered-table-cell":
+				if ! inCell {
+					continue
+				}
+				inCell = false
+				v := cellValue
+				if len(v) == 0 {
+					v = strings.Join(text, "\n")
+				}
+				if len(v) == 0 {
+					emptyCells += cellRepeat
+					continue
+				}
+				for ; emptyCells > 0; emptyCells-- {
+					row = append(row, "")
+				}
+				for i := 0; i < cellRepeat; i++ {
+					row = append(row, v)
+				}
+			case "table-row":
+				if ! inRow {
+					continue
+				}
+				inRow = false
+				if len(row) == 0 {
+					emptyRows += rowRepeat
+					continue
+				}
+				for ; emptyRows > 0; emptyRows-- {
+					cells = append(cells, []string{})
+				}
+				for i := 0; i < rowRepeat; i++ {
+					cells = append(cells, row)
+				}
+			case "table":
+				inTable = false
+				wsCells = append(wsCells, cells)
+			}
+		}
+	}
+
+	return wsNames, wsCells, nil
+}
+
+func odsAttr(t xml.StartElement, space, local string) string {
+	for _, a := range t.Attr {
+		if a.Name.Space == space && a.Name.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// odsDuration converts duration of ods, such as PT01H30M00S, to the form
+// of go, such as 1h30m0s. days are written as 2d. returns "" if v is not
+// a valid duration.
+func odsDuration(v string) string {
+	m := reOdsDuration.FindStringSubmatch(v)
+	if m == nil {
+		return ""
+	}
+	d := m[1]
+	for i, unit := range []string{ "d", "h", "m" } {
+		if len(m[i+2]) > 0 {
+			n, err := strconv.Atoi(m[i+2])
+			if err != nil {
+				return ""
+			}
+			d += strconv.Itoa(n) + unit
+		}
+	}
+	if len(m[5]) > 0 {
+		sec := strings.TrimLeft(m[5], "0")
+		if len(sec) == 0 || sec[0] == '.' {
+			sec = "0" + sec
+		}
+		d += sec + "s"
+	}
+	if d == m[1] {
+		return ""
+	}
+	return d
+}
+
+func odsRepeat(t xml.StartElement, local string) int {
+	v := odsAttr(t, odsNsTable, local)
+	if len(v) == 0 {
+		return 1
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		return 1
+	}
+	return n
+}
+
+func init() {
+	ErrCannotReadOds = errors.New("ods 파일을 읽을 수 없음")
+
+	reOdsDuration, _ = regexp.Compile(
+		`^(-?)P(?:([0-9]+)D)?(?:T(?:([0-9]+)H)?(?:([0-9]+)M)?(?:([0-9]+(?:\.[0-9]+)?)S)?)?$`)
+}
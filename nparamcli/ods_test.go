@@ -0,0 +1,178 @@
+package nparamcli
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const odsTestHeader = `<?xml version="1.0" encoding="UTF-8"?>
+<office:document-content
+ xmlns:office="urn:oasis:names:tc:opendocument:xmlns:office:1.0"
+ xmlns:table="urn:oasis:names:tc:opendocument:xmlns:table:1.0"
+ xmlns:text="urn:oasis:names:tc:opendocument:xmlns:text:1.0">
+<office:body><office:spreadsheet>`
+
+const odsTestFooter = `</office:spreadsheet></office:body></office:document-content>`
+
+func TestReadOdsContent(t *testing.T) {
+	tests := []struct {
+		name  string
+		sheet string
+		cells [][]string
+	}{
+		{
+			name: "repeated rows and columns",
+			sheet: `<table:table-row table:number-rows-repeated="2">` +
+				`<table:table-cell table:number-columns-repeated="3"><text:p>a</text:p></table:table-cell>` +
+				`</table:table-row>`,
+			cells: [][]string{ {"a", "a", "a"}, {"a", "a", "a"} },
+		},
+		{
+			name: "empty cells and rows between values",
+			sheet: `<table:table-row>` +
+				`<table:table-cell><text:p>a</text:p></table:table-cell>` +
+				`<table:table-cell table:number-columns-repeated="2"/>` +
+				`<table:table-cell><text:p>b</text:p></table:table-cell>` +
+				`</table:table-row>` +
+				`<table:table-row table:number-rows-repeated="2"><table:table-cell/></table:table-row>` +
+				`<table:table-row><table:table-cell><text:p>c</text:p></table:table-cell></table:table-row>`,
+			cells: [][]string{ {"a", "", "", "b"}, {}, {}, {"c"} },
+		},
+		{
+			name: "trailing empty cells and rows",
+			sheet: `<table:table-row>` +
+				`<table:table-cell><text:p>a</text:p></table:table-cell>` +
+				`<table:table-cell table:number-columns-repeated="1020"/>` +
+				`</table:table-row>` +
+				`<table:table-row table:number-rows-repeated="1048575">` +
+				`<table:table-cell table:number-columns-repeated="1024"/>` +
+				`</table:table-row>`,
+			cells: [][]string{ {"a"} },
+		},
+		{
+			name: "spaces, tabs and line breaks",
+			sheet: `<table:table-row><table:table-cell>` +
+				`<text:p>a<text:s/>b<text:s text:c="3"/>c<text:tab/>d</text:p>` +
+				`<text:p>e<text:line-break/>f</text:p>` +
+				`</table:table-cell></table:table-row>`,
+			cells: [][]string{ {"a b   c\td\ne\nf"} },
+		},
+		{
+			name: "annotation",
+			sheet: `<table:table-row><table:table-cell>` +
+				`<office:annotation><text:p>comment</text:p></office:annotation>` +
+				`<text:p>a</text:p>` +
+				`</table:table-cell></table:table-row>`,
+			cells: [][]string{ {"a"} },
+		},
+		{
+			name: "typed values",
+			sheet: `<table:table-row>` +
+				`<table:table-cell office:value-type="float" office:value="0.1"><text:p>0.10</text:p></table:table-cell>` +
+				`<table:table-cell office:value-type="boolean" office:boolean-value="true"><text:p>TRUE</text:p></table:table-cell>` +
+				`<table:table-cell office:value-type="date" office:date-value="2016-05-17T10:00:00"><text:p>05/17/16 10:00</text:p></table:table-cell>` +
+				`<table:table-cell office:value-type="date" office:date-value="2016-05-17"><text:p>05/17/16</text:p></table:table-cell>` +
+				`<table:table-cell office:value-type="time" office:time-value="PT01H30M00S"><text:p>01:30:00</text:p></table:table-cell>` +
+				`<table:table-cell office:value-type="time" office:time-value="bad"><text:p>01:30</text:p></table:table-cell>` +
+				`</table:table-row>`,
+			cells: [][]string{
+				{"0.1", "TRUE", "2016-05-17T10:00:00", "2016-05-17", "1h30m0s", "01:30"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := odsTestHeader +
+				`<table:table table:name="Sheet1">` + tt.sheet + `</table:table>` +
+				odsTestFooter
+			names, cells, err := readOdsContent(strings.NewReader(content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ! reflect.DeepEqual(names, []string{ "Sheet1" }) {
+				t.Errorf("names %q", names)
+			}
+			if len(cells) != 1 || ! reflect.DeepEqual(cells[0], tt.cells) {
+				t.Errorf("cells %q, want %q", cells, tt.cells)
+			}
+		})
+	}
+}
+
+func TestOdsDuration(t *testing.T) {
+	tests := []struct {
+		v    string
+		want string
+	}{
+		{ "PT01H30M00S", "1h30m0s" },
+		{ "PT0H0M1.5S", "0h0m1.5s" },
+		{ "PT00H00M00.250S", "0h0m0.250s" },
+		{ "-PT12H", "-12h" },
+		{ "P2DT03H", "2d3h" },
+		{ "PT", "" },
+		{ "P", "" },
+		{ "01:30:00", "" },
+	}
+	for _, tt := range tests {
+		got := odsDuration(tt.v)
+		if got != tt.want {
+			t.Errorf("odsDuration(%q) = %q, want %q", tt.v, got, tt.want)
+		}
+	}
+}
+
+func TestParseOds(t *testing.T) {
+	row := func(vs ...string) string {
+		s := "<table:table-row>"
+		for _, v := range vs {
+			s += "<table:table-cell><text:p>" + v + "</text:p></table:table-cell>"
+		}
+		return s + "</table:table-row>"
+	}
+	content := odsTestHeader +
+		`<table:table table:name="Sheet1">` +
+		row("$const", "MaxLevel", "100") +
+		row("$table", "Item") +
+		row("id", "hp", "$end") +
+		row("$autokey", "$int") +
+		row("Sword", "10") +
+		row("$end") +
+		`</table:table>` +
+		odsTestFooter
+
+	fn := filepath.Join(t.TempDir(), "a" + extOds)
+	f, err := os.Create(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	w, err := zw.Create(odsContentFn)
+	if err == nil {
+		_, err = w.Write([]byte(content))
+	}
+	if err == nil {
+		err = zw.Close()
+	}
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cdefs, tms, tds, err := ParseOds(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cdefs) != 1 || cdefs[0].Name != "MaxLevel" || cdefs[0].Value != 100 {
+		t.Errorf("consts: %+v", cdefs)
+	}
+	if len(tms) != 1 || tms[0].Name != "Item" {
+		t.Fatalf("tables: %v", tms)
+	}
+	if ! reflect.DeepEqual(tds[0], [][]string{ {"Sword", "10"} }) {
+		t.Errorf("data %q", tds[0])
+	}
+}
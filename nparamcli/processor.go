@@ -3,13 +3,16 @@ package nparamcli
 import (
 	"bytes"
 	//"fmt"
+	"math"
+	"math/bits"
 	"os"
 	"os/exec"
-	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"text/template"
 	"time"
+	"unicode/utf8"
 
 	"github.com/bluegol/errutil"
 	"github.com/golang/protobuf/proto"
@@ -37,6 +40,8 @@ type processor struct {
 	tds          map[string]*tableData
 	//
 	protoFns     []string
+	// texts of all tables. nil if there's no text field.
+	texts        []*textEntry
 }
 
 type inputInfo struct {
@@ -93,9 +98,9 @@ func (proc *processor) processInputs() error {
 	filesToProcess := map[string][]byte{}
 	// table ==> file
 	tables := map[string]string{}
-	currentFns, err := filepath.Glob("*")
+	currentFns, err := findSourceFiles(proc.config.Sources)
 	if err != nil {
-		return errutil.AssertEmbed(err, errutil.MoreInfo, "while globbing")
+		return err
 	}
 
 	prevInputs := map[string]*inputInfo{}
@@ -110,8 +115,7 @@ func (proc *processor) processInputs() error {
 	}
 	outerLoop:
 	for _, fn := range currentFns {
-		_, _, ext := DecomposePath(fn)
-		if ext != extXlsx && ext != extTable && ext != extConst {
+		if ! isInputFile(fn) {
 			continue
 		}
 		// compare hash of input file
@@ -174,62 +178,49 @@ func (proc *processor) processInputs() error {
 		iinfo := &inputInfo{ InputFile: fn, Hash: hash }
 		_, _, ext := DecomposePath(fn)
 		if ext == extXlsx {
-			outFns := []string{}
 			cdefs, tms, tdata, err := ParseXlsx(fn)
 			if err != nil {
 				return err
 			}
-			constFn := intermediateConstFileName(fn)
-			cdf := &cdefFile{ Src: fn, ConstFn: constFn, Consts: cdefs }
-			err = WriteYamlFile(constFn, cdf)
+			iinfo.OutputFiles, err = writeParsedInput(
+				fn, cdefs, tms, tdata, tables)
 			if err != nil {
-				return errutil.AssertEmbed(err,
-					errutil.MoreInfo, "while const",
-					"file", fn, "const_file", constFn)
-			}
-			outFns = append(outFns, constFn)
-			for i, tm := range tms {
-				var tmFn, tdFn string
-				if tm.Partial {
-					// table will be merged
-					tmFn = tableMetaFileName(fn, tm.Name)
-					tmFn = ChangeExt(tmFn, extPartialTableMeta)
-					tdFn = ChangeExt(tmFn, extPartialTableData)
-					prev, exists := tables[tm.Name]
-					if exists {
-						return errutil.New(ErrDuplicateTblNames,
-							"table_name", tm.Name,
-							"file1", prev, "file2", fn)
-					}
-				} else {
-					tmFn = tableMetaFileName(fn, tm.Name)
-					tdFn = ChangeExt(tmFn, extTableData)
-					tables[tm.Name] = fn
-				}
-				tm.TmFileName = tmFn
-				err = WriteYamlFile(tmFn, tm)
-				if err != nil {
-					return errutil.AssertEmbed(err,
-						errutil.MoreInfo, "while tm",
-						"file", fn, "tm_file", tmFn)
-				}
-				outFns = append(outFns, tmFn)
-				err = WriteYamlFile(tdFn, tdata[i])
-				if err != nil {
-					return errutil.AssertEmbed(err,
-						errutil.MoreInfo, "while td",
-						"file", fn, "td_file", tdFn)
-				}
-				outFns = append(outFns, tdFn)
+				return err
+			}
+		} else if ext == extOds {
+			cdefs, tms, tdata, err := ParseOds(fn)
+			if err != nil {
+				return err
+			}
+			iinfo.OutputFiles, err = writeParsedInput(
+				fn, cdefs, tms, tdata, tables)
+			if err != nil {
+				return err
 			}
-			iinfo.OutputFiles = outFns
 		} else if ext == extTable {
-
-
-			// \todo handle .table file
-			panic("TODO: .table file")
-
-
+			cdefs, tms, tdata, err := ParseTableFile(fn)
+			if err != nil {
+				return err
+			}
+			iinfo.OutputFiles, err = writeParsedInput(
+				fn, cdefs, tms, tdata, tables)
+			if err != nil {
+				return err
+			}
+		} else if ext == extCsv || ext == extTsv {
+			comma := ','
+			if ext == extTsv {
+				comma = '\t'
+			}
+			cdefs, tms, tdata, err := ParseCsv(fn, comma)
+			if err != nil {
+				return err
+			}
+			iinfo.OutputFiles, err = writeParsedInput(
+				fn, cdefs, tms, tdata, tables)
+			if err != nil {
+				return err
+			}
 		} else if ext == extConst {
 			cdefs := []*cdef{}
 			err := ReadYamlFile(fn, &cdefs)
@@ -313,6 +304,61 @@ func (proc *processor) processInputs() error {
 	return nil
 }
 
+// writeParsedInput writes consts and tables parsed from input file fn
+// into intermediate files, and returns the names of the written files.
+// tables is table name ==> file, to check duplicate table names
+// across input files.
+func writeParsedInput(fn string, cdefs []*cdef,
+	tms []*tableMeta, tdata [][][]string,
+	tables map[string]string) ([]string, error) {
+
+	outFns := []string{}
+	constFn := intermediateConstFileName(fn)
+	cdf := &cdefFile{ Src: fn, ConstFn: constFn, Consts: cdefs }
+	err := WriteYamlFile(constFn, cdf)
+	if err != nil {
+		return nil, errutil.AssertEmbed(err,
+			errutil.MoreInfo, "while const",
+			"file", fn, "const_file", constFn)
+	}
+	outFns = append(outFns, constFn)
+	for i, tm := range tms {
+		var tmFn, tdFn string
+		if tm.Partial {
+			// table will be merged
+			tmFn = tableMetaFileName(fn, tm.Name)
+			tmFn = ChangeExt(tmFn, extPartialTableMeta)
+			tdFn = ChangeExt(tmFn, extPartialTableData)
+			prev, exists := tables[tm.Name]
+			if exists {
+				return nil, errutil.New(ErrDuplicateTblNames,
+					"table_name", tm.Name,
+					"file1", prev, "file2", fn)
+			}
+		} else {
+			tmFn = tableMetaFileName(fn, tm.Name)
+			tdFn = ChangeExt(tmFn, extTableData)
+			tables[tm.Name] = fn
+		}
+		tm.TmFileName = tmFn
+		err = WriteYamlFile(tmFn, tm)
+		if err != nil {
+			return nil, errutil.AssertEmbed(err,
+				errutil.MoreInfo, "while tm",
+				"file", fn, "tm_file", tmFn)
+		}
+		outFns = append(outFns, tmFn)
+		err = WriteYamlFile(tdFn, tdata[i])
+		if err != nil {
+			return nil, errutil.AssertEmbed(err,
+				errutil.MoreInfo, "while td",
+				"file", fn, "td_file", tdFn)
+		}
+		outFns = append(outFns, tdFn)
+	}
+	return outFns, nil
+}
+
 func removeOutputs(outFn string) error {
 	_, fnOnly, ext := DecomposePath(outFn)
 	_, tn, _ := DecomposePath(fnOnly)
@@ -683,6 +729,7 @@ func (proc *processor) mergeTable(tn string, fns []string) error {
 	var mergedTblm *tableMeta
 	srcs := []string{}
 	newKeys := []string{}
+	rowLocs := []string{}
 	for _, fn := range fns {
 		tm := &tableMeta{}
 		err := ReadYamlFile(fn, tm)
@@ -701,9 +748,13 @@ func (proc *processor) mergeTable(tn string, fns []string) error {
 				"orig_file", fns[0])
 		}
 		newKeys = append(newKeys, tm.AutoKeyNames...)
+		for _, l := range tm.RowLocs {
+			rowLocs = append(rowLocs, fileLoc(tm.Src, l))
+		}
 		srcs = append(srcs, tm.Src)
 	}
 	mergedTblm.AutoKeyNames = newKeys
+	mergedTblm.RowLocs = rowLocs
 	mergedTblm.TmFileName = mergedTableMetaFileName(tn)
 	mergedTblm.Src = strings.Join(srcs, ", ")
 	err := WriteYamlFile(mergedTblm.TmFileName, mergedTblm)
@@ -782,10 +833,10 @@ func (proc *processor) processTableMetas() error {
 				"table_name", tm.Name,
 				"prev_file", prev.Src, "file", tm.Src)
 			if len(prev.XlsxLoc) > 0 {
-				err = errutil.AddInfo(err, "prev_xlsx_loc", prev.XlsxLoc)
+				err = errutil.AddInfo(err, "prev_loc", prev.XlsxLoc)
 			}
 			if len(tm.XlsxLoc) > 0 {
-				err = errutil.AddInfo(err, "xlsx_loc", tm.XlsxLoc)
+				err = errutil.AddInfo(err, "loc", tm.XlsxLoc)
 			}
 			return err
 		}
@@ -805,17 +856,11 @@ func (proc *processor) processTableMetas() error {
 		if err != nil {
 			return err
 		}
-		for _, fi := range tm.Fields {
-			err = proc.st.AddSymbol(fi.symbolInfo)
-			if err != nil {
-				return err
-			}
-			for _, sfi := range fi.Subs {
-				err = proc.st.AddSymbol(sfi.symbolInfo)
-				if err != nil {
-					return err
-				}
-			}
+		err = tm.forEachField(func(path []string, fi *fieldDef) error {
+			return proc.st.AddSymbol(fi.symbolInfo)
+		})
+		if err != nil {
+			return err
 		}
 		for _, ak := range tm.AutoKeys {
 			err = proc.st.AddSymbol(ak)
@@ -853,21 +898,15 @@ func (proc *processor) processTableMetas() error {
 		if err != nil {
 			return err
 		}
-		for _, fi := range tm.Fields {
+		err = tm.forEachField(func(path []string, fi *fieldDef) error {
+			var err error
 			fi.symbolInfo, err = proc.st.AddNewSymbol(
-				FieldSymbolName(tm.Name, fi.Name, ""),
+				FieldSymbolName(tm.Name, path...),
 				tm.Src, tm.Name, stField, 0)
-			if err != nil {
-				return err
-			}
-			for _, sfi := range fi.Subs {
-				sfi.symbolInfo, err = proc.st.AddNewSymbol(
-					FieldSymbolName(tm.Name, fi.Name, sfi.Name),
-					tm.Src, tm.Name, stField, 0)
-				if err != nil {
-					return err
-				}
-			}
+			return err
+		})
+		if err != nil {
+			return err
 		}
 		tm.AutoKeys = make([]*symbolInfo, len(tm.AutoKeyNames))
 		for i, name := range tm.AutoKeyNames {
@@ -893,23 +932,18 @@ func (proc *processor) processTableMetas() error {
 			return errutil.NewAssert(errutil.MoreInfo, "no id?", "name", name)
 		}
 		param = append(param, sinfo.Id)
-		for _, fi := range tm.Fields {
-			name = FieldSymbolName(tm.Name, fi.Name, "")
-			sinfo = proc.st.Find(name)
+		err = tm.forEachField(func(path []string, fi *fieldDef) error {
+			name := FieldSymbolName(tm.Name, path...)
+			sinfo := proc.st.Find(name)
 			if sinfo == nil {
 				return errutil.NewAssert(errutil.MoreInfo, "no id?", "name", name)
 			}
 			param = append(param, sinfo.Id)
 			fieldSymbolById[sinfo.Id] = sinfo
-			for _, sfi := range fi.Subs {
-				name = FieldSymbolName(tm.Name, fi.Name, sfi.Name)
-				sinfo = proc.st.Find(name)
-				if sinfo == nil {
-					return errutil.NewAssert(errutil.MoreInfo, "no id?", "name", name)
-				}
-				param = append(param, sinfo.Id)
-				fieldSymbolById[sinfo.Id] = sinfo
-			}
+			return nil
+		})
+		if err != nil {
+			return err
 		}
 		result, err := GetFieldTagsFromServer(proc.config.serverCmdField(), param)
 		if err != nil {
@@ -924,27 +958,48 @@ func (proc *processor) processTableMetas() error {
 			}
 			sinfo.Value = tag
 		}
-		// set proto key
-		for _, fi := range tm.Fields {
-			err := fi.SetProtoKey()
+		// resolve enums of const group, and set proto key
+		err = tm.forEachField(func(path []string, fi *fieldDef) error {
+			_, err := proc.resolveEnumGroup(fi)
 			if err != nil {
-				return errutil.AddInfo(err, "table", tm.Name)
-			}
-			for _, sfi := range fi.Subs {
-				err = sfi.SetProtoKey()
-				if err != nil {
-					return errutil.AddInfo(err, "table", tm.Name)
-				}
+				return err
 			}
+			return fi.SetProtoKey()
+		})
+		if err != nil {
+			return errutil.AddInfo(err, "table", tm.Name)
 		}
 		proc.logger.Info("resolved field tags", "table", tm.Name)
 	}
+	// consts may have been changed after tm was resolved, so resolve
+	// enums of const group again. changed tm is saved again, so that
+	// proto and td are processed again.
+	for _, tm := range proc.tms {
+		if ! tm.Resolved {
+			continue
+		}
+
+		anyChange := false
+		err = tm.forEachField(func(path []string, fi *fieldDef) error {
+			changed, err := proc.resolveEnumGroup(fi)
+			anyChange = anyChange || changed
+			return err
+		})
+		if err != nil {
+			return errutil.AddInfo(err, "table", tm.Name)
+		}
+		if anyChange {
+			tm.Resolved = false
+			proc.logger.Info("enum of const group changed", "table", tm.Name)
+		}
+	}
 	// save newly resolved tm files
 	for _, tm := range proc.tms {
 		if tm.Resolved {
 			continue
 		}
 
+		proc.setZigZag(tm.Fields)
 		tm.Resolved = true
 		rtmFn := ChangeExt(tm.TmFileName, extResolvedTableMeta)
 		err := WriteYamlFile(rtmFn, tm)
@@ -958,6 +1013,85 @@ func (proc *processor) processTableMetas() error {
 	return nil
 }
 
+// setZigZag sets ZigZag of the signed fields whose min is negative.
+// min may be a const, so this is done after consts are processed.
+// SRTable references are not resolved yet, so they are not considered.
+func (proc *processor) setZigZag(fields []*fieldDef) {
+	for _, fi := range fields {
+		proc.setZigZag(fi.Subs)
+		if ! fi.isSigned() || fi.ZigZag || len(fi.MinStr) == 0 {
+			continue
+		}
+		tName, _ := DecomposeSRTableReference(fi.MinStr)
+		if len(tName) > 0 {
+			continue
+		}
+		// invalid min is reported when table data is resolved
+		min, err := proc.resolveInt(fi.MinStr, fi.Type, nil)
+		if err == nil && min < 0 {
+			fi.ZigZag = true
+		}
+	}
+}
+
+// resolveEnumGroup sets enum names and values of the field
+// from the consts of its const group. names are without the group prefix,
+// and are ordered by value. returns whether names or values are changed.
+func (proc *processor) resolveEnumGroup(fi *fieldDef) (bool, error) {
+	if fi.Type == vtMap {
+		return proc.resolveEnumGroup(fi.MapValue)
+	}
+	if fi.Type != vtEnum || len(fi.EnumGroup) == 0 {
+		return false, nil
+	}
+	prefix := fi.EnumGroup + "_"
+	consts := []*cdef{}
+	for _, cdf := range proc.consts {
+		for _, c := range cdf.Consts {
+			if strings.HasPrefix(c.Name, prefix) && len(c.Name) > len(prefix) {
+				consts = append(consts, c)
+			}
+		}
+	}
+	if len(consts) == 0 {
+		return false, errutil.New(ErrInvalidFieldDef,
+			errutil.MoreInfo, "no const in const group of " + kwFieldTypeEnum +
+				". single value is the name of const group." +
+				" for enum of names, specify two or more names",
+			"group", fi.EnumGroup, "field", fi.Name)
+	}
+	sort.Slice(consts, func(i, j int) bool {
+		if consts[i].Value != consts[j].Value {
+			return consts[i].Value < consts[j].Value
+		}
+		return consts[i].Name < consts[j].Name
+	})
+	names := make([]string, len(consts))
+	values := make([]int, len(consts))
+	changed := len(consts) != len(fi.EnumNames)
+	for i, c := range consts {
+		if c.Value < math.MinInt32 || c.Value > math.MaxInt32 {
+			return false, errutil.New(ErrIntOutOfRange,
+				errutil.MoreInfo, "enum value must be int32",
+				"const", c.Name, "value", strconv.Itoa(c.Value),
+				"field", fi.Name)
+		}
+		names[i] = c.Name[len(prefix):]
+		values[i] = c.Value
+		if names[i] == enumUnspecified && c.Value != 0 {
+			return false, errutil.New(ErrInvalidFieldDef,
+				errutil.MoreInfo, enumUnspecified + " is reserved for 0",
+				"const", c.Name, "field", fi.Name)
+		}
+		if ! changed &&
+			(names[i] != fi.EnumNames[i] || values[i] != fi.EnumValues[i]) {
+			changed = true
+		}
+	}
+	fi.EnumNames, fi.EnumValues = names, values
+	return changed, nil
+}
+
 func (proc *processor) resolveTableData() error {
 	time.Sleep(time.Second)
 	proc.logger.Info("resolving table data...")
@@ -1026,9 +1160,12 @@ func (proc *processor) resolveTableData() error {
 		if ! needReprocess {
 			for parentName, _ := range td.ReferencedTms {
 				parentTm := proc.tms[parentName]
+				if parentTm == nil {
+					needReprocess = true
+					break
+				}
 				parentRtmFn := ChangeExt(parentTm.TmFileName, extResolvedTableMeta)
-				if parentTm == nil ||
-					! FileExists(parentRtmFn) ||
+				if ! FileExists(parentRtmFn) ||
 					NeedToProcess(parentRtmFn, rtdFn) {
 					needReprocess = true
 					break
@@ -1126,47 +1263,81 @@ func (proc *processor) setTableDataReferences(td *tableData) error {
 	td.ReferencedTms[td.Name] = true
 
 	// from field opts
-	for _, fi := range td.tableMeta.Fields {
-		if len(fi.Subs) == 0 {
-			proc.addReferencesFromField(fi, td)
-		} else {
-			for _, sfi := range fi.Subs {
-				proc.addReferencesFromField(sfi, td)
-			}
+	err := td.tableMeta.forEachField(func(path []string, fi *fieldDef) error {
+		proc.addReferencesFromField(fi, td)
+		if fi.MapValue != nil {
+			fi = fi.MapValue
+		}
+		if len(fi.Ref) > 0 {
+			_, err := proc.refTable(td, fi)
+			return err
 		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 	// from values
 	for _, row := range td.RawData {
-		for _, v := range row {
-			r1, r2 := proc.getReferenceFromValue(v)
-			if len(r1) > 0 {
-				td.ReferencedKeys[v] = true
-				td.ReferencedTms[r1] = true
-			} else if len(r2) > 0 {
-				td.ReferencedTds[r2] = true
+		for j, v := range row {
+			values := []string{ v }
+			fi := td.fieldsByOrder[j]
+			if fi.Type == vtString || fi.Type == vtText {
+				continue
+			}
+			// invalid list or map is reported when resolving values
+			if fi.List {
+				values, _ = splitList(v)
+			} else if fi.Type == vtMap {
+				keys, mapValues, _ := splitMap(v)
+				values = append(keys, mapValues...)
+			}
+			for _, v := range values {
+				proc.addReferencesFromValue(v, td)
 			}
 		}
 	}
 	return nil
 }
 
+// addReferencesFromValue adds references of value v, or of
+// each operand if v is an expression.
+func (proc *processor) addReferencesFromValue(v string, td *tableData) {
+	for _, o := range ValueOperands(v) {
+		r1, r2 := proc.getReferenceFromValue(o)
+		if len(r1) > 0 {
+			td.ReferencedKeys[o] = true
+			td.ReferencedTms[r1] = true
+		} else if len(r2) > 0 {
+			td.ReferencedTds[r2] = true
+		}
+	}
+}
+
 func (proc *processor) addReferencesFromField(fi *fieldDef, td *tableData) {
+	if fi.Type == vtMap {
+		proc.addReferencesFromField(fi.MapKey, td)
+		proc.addReferencesFromField(fi.MapValue, td)
+		return
+	}
 	for tName, _ := range fi.KeysOf {
 		td.ReferencedTms[tName] = true
 	}
-	v := fi.MinStr
-	if len(v) > 0 {
-		_, r2 := proc.getReferenceFromValue(v)
-		if len(r2) > 0 {
-			td.ReferencedTds[r2] = true
+	// keys of td itself are resolved before the other fields
+	if len(fi.Ref) > 0 {
+		td.ReferencedTms[fi.Ref] = true
+		if fi.Ref != td.Name {
+			td.ReferencedTds[fi.Ref] = true
 		}
 	}
-	v = fi.MaxStr
-	if len(v) > 0 {
-		_, r2 := proc.getReferenceFromValue(v)
-		if len(r2) > 0 {
-			td.ReferencedTds[r2] = true
-		}
+	if len(fi.MinStr) > 0 {
+		proc.addReferencesFromValue(fi.MinStr, td)
+	}
+	if len(fi.DefaultStr) > 0 && fi.Type != vtString && fi.Type != vtText {
+		proc.addReferencesFromValue(fi.DefaultStr, td)
+	}
+	if len(fi.MaxStr) > 0 {
+		proc.addReferencesFromValue(fi.MaxStr, td)
 	}
 }
 
@@ -1189,6 +1360,10 @@ func (proc *processor) getReferenceFromValue(v string) (string, string) {
 	if len(tName) > 0 {
 		return "", tName
 	}
+	tName, _, _ = DecomposeRowReference(v)
+	if len(tName) > 0 {
+		return "", tName
+	}
 	// error will be handled later when resolving values
 	return "", ""
 }
@@ -1226,246 +1401,978 @@ func (proc *processor) resolveTd(td *tableData) error {
 	for i := 0; i < numRows; i++ {
 		td.Data[i] = make([]int, numFields)
 	}
+	td.ListData = nil
 
-	var err error
+	// key columns first, so that rows are reported by their keys
+	cols := td.keyColumns()
+	isKey := map[int]bool{}
+	for _, j := range cols {
+		isKey[j] = true
+	}
 	for j := 0; j < numFields; j++ {
-		fi := td.tableMeta.fieldsByOrder[j]
-		// resolve field opts
-		if len(fi.MinStr) > 0 {
-			fi.Min, err = proc.resolveInt(fi.MinStr, fi.Type == vtFixed4, nil)
+		if ! isKey[j] {
+			cols = append(cols, j)
 		}
-		if len(fi.MaxStr) > 0 {
-			fi.Max, err = proc.resolveInt(fi.MaxStr, fi.Type == vtFixed4, nil)
+	}
+
+	var err error
+	for _, j := range cols {
+		fi := td.tableMeta.fieldsByOrder[j]
+		err = proc.resolveFieldOpts(fi)
+		if err != nil {
+			return errutil.AddInfo(err, "table", td.Name, "field", fi.Name)
 		}
 
 		// resolve table values
-		if fi.Type == vtId {
-			srcTables := []string{}
-			for i := 0; i < numRows; i++ {
-				var srcTable string
-				td.Data[i][j], srcTable, err = proc.resolveId(td.RawData[i][j])
-				if err != nil {
-					return errutil.AddInfo(err,
-						"table", td.Name,
-						"row_key", td.RawData[i][0], "field", fi.Name)
-				}
-				srcTables = append(srcTables, srcTable)
-			}
-			// check with fi.KeysOf
-			if ! fi.AutoKey && fi.KeysOf != nil {
-				for i := 0; i < numRows; i++ {
-					_, exists := fi.KeysOf[srcTables[i]]
-					if ! exists {
-						tbls := []string{}
-						for t, _ := range fi.KeysOf {
-							tbls = append(tbls, t)
-						}
-						return errutil.New(ErrKeyOutOfRange,
-							"value", td.RawData[i][j],
-							"defined_in", srcTables[i],
-							"must_be_keys_of", strings.Join(tbls, " "),
-							"table", td.Name,
-							"row_key", td.RawData[i][0],
-							"field", fi.Name)
+		for i := 0; i < numRows; i++ {
+			if fi.List || fi.Type == vtMap {
+				if td.ListData == nil {
+					td.ListData = make([][][]int, numRows)
+					for ii := 0; ii < numRows; ii++ {
+						td.ListData[ii] = make([][]int, numFields)
 					}
 				}
-			}
-		} else if fi.Type == vtInt || fi.Type == vtFixed4 {
-			fixed4 := fi.Type == vtFixed4
-			for i := 0; i < numRows; i++ {
-				td.Data[i][j], err = proc.resolveInt(
-					td.RawData[i][j], fixed4, fi.Units)
-				if err != nil {
-					return errutil.AddInfo(err,
-						"table", td.Name,
-						"row_key", td.RawData[i][0],
-						"field", fi.Name)
-				}
-			}
-			// check min
-			if len(fi.MinStr) > 0 {
-				for i := 0; i < numRows; i++ {
-					if td.Data[i][j] < fi.Min {
-						return errutil.New(ErrIntOutOfRange,
-							"value", strconv.Itoa(td.Data[i][j]),
-							"raw_value", td.RawData[i][j],
-							"min", strconv.Itoa(fi.Min),
-							"table", td.Name,
-							"row_key", td.RawData[i][0],
-							"field", fi.Name)
-					}
+				if fi.List {
+					td.ListData[i][j], err = proc.resolveList(fi, td.RawData[i][j])
+				} else {
+					td.ListData[i][j], err = proc.resolveMap(fi, td.RawData[i][j])
 				}
+			} else {
+				td.Data[i][j], err = proc.resolveValue(fi, td.RawData[i][j])
 			}
-			// check max
-			if len(fi.MaxStr) > 0 {
-				for i := 0; i < numRows; i++ {
-					if td.Data[i][j] > fi.Max {
-						return errutil.New(ErrIntOutOfRange,
-							"value", strconv.Itoa(td.Data[i][j]),
-							"raw_value", td.RawData[i][j],
-							"max", strconv.Itoa(fi.Max),
-							"table", td.Name,
-							"row_key", td.RawData[i][0],
-							"field", fi.Name)
-					}
+			if err != nil {
+				rowKey := td.RawData[i][j]
+				if ! isKey[j] {
+					rowKey = td.rowKey(i)
 				}
+				return errutil.AddInfo(err,
+					"table", td.Name,
+					"row_key", rowKey,
+					"field", fi.Name,
+					"loc", td.RowLoc(i))
 			}
-		} else if fi.Type == vtString {
-			// do nothing.
-		} else {
-			return errutil.NewAssert(
-				"table", td.Name,
-				"field", fi.Name,
-				"value_type", fi.TypeString() )
 		}
 	}
 
-	td.Resolved = true
-	return nil
-}
-
-func (proc *processor) resolveId(v string) (int, string, error) {
-	sinfo := proc.st.Find(v)
-	if sinfo == nil {
-		return 0, "", errutil.New(ErrUndefinedSymbol, "value", v)
+	err = checkKeys(td)
+	if err != nil {
+		return err
 	}
-	if sinfo.Type != stAutoKey {
-		return 0, "", errutil.New(ErrNotAutoKey,
-			"value", v, "type", typeString(sinfo.Type))
+	err = checkUnique(td)
+	if err != nil {
+		return err
+	}
+	err = proc.checkCoverAll(td)
+	if err != nil {
+		return err
+	}
+	err = proc.checkRefs(td)
+	if err != nil {
+		return err
 	}
 
-	return sinfo.Id, sinfo.SrcTable, nil
+	td.Resolved = true
+	return nil
 }
 
-func (proc *processor) resolveInt(
-	v string, fixed4 bool, units map[string]int) (int, error) {
-
-	if len(v) == 0 {
-		return 0, nil
+// checkKeys checks if the keys are unique. merged partial tables are
+// checked here, as well as int keys and composite keys.
+func checkKeys(td *tableData) error {
+	if td.SingleRow {
+		return nil
 	}
-	ok, i, dexists, d, unit := DecomposeValue(v)
-	if ok {
-		unitMult := 1
-		if len(unit) > 0 {
-			var exists bool
-			unitMult, exists = units[unit]
-			if ! exists {
-				return 0, errutil.New(ErrInvalidInt,
-					errutil.MoreInfo, "unspecified unit",
-					"unit", unit, "value", v)
-			}
+	cols := td.keyColumns()
+	// key ==> row
+	seen := map[string]int{}
+	values := make([]string, len(cols))
+	for i, intLine := range td.Data {
+		for k, j := range cols {
+			values[k] = strconv.Itoa(intLine[j])
 		}
-		// \todo check overflow
-		var result int
-		if fixed4 {
-			result = ( Fixed4Mult*i + d ) * unitMult
-		} else {
-			if dexists {
-				return 0, errutil.New(ErrInvalidInt, "value", v)
-			}
-			result = i * unitMult
+		key := strings.Join(values, ",")
+		prev, exists := seen[key]
+		if exists {
+			return errutil.New(ErrDuplicateKey,
+				"table", td.Name, "row_key", td.rowKey(i),
+				"loc", td.RowLoc(i),
+				"prev_row_key", td.rowKey(prev),
+				"prev_loc", td.RowLoc(prev))
 		}
-		return result, nil
+		seen[key] = i
 	}
+	return nil
+}
 
-	tName, fName := DecomposeSRTableReference(v)
-	if len(tName) > 0 {
-		td, exists := proc.tds[tName]
-		if ! exists {
-			return 0, errutil.NewAssert("table", tName, "value", v)
-		}
-		if ! td.SingleRow {
-			return 0, errutil.New(ErrInvalidSRTableReference,
-				errutil.MoreInfo, "referenced table is not single-row",
-				"value", v)
+// checkCoverAll checks if every autokey of $keysof tables appears in
+// the values of each $coverall field. values of all the columns of
+// the field, i.e. elements of array, list or keys of map, are counted.
+func (proc *processor) checkCoverAll(td *tableData) error {
+	fields := []*fieldDef{}
+	covered := map[*fieldDef]map[int]bool{}
+	for j, fi := range td.fieldsByOrder {
+		cfi := fi
+		if fi.Type == vtMap {
+			cfi = fi.MapKey
+		}
+		if ! cfi.CoverAll {
+			continue
 		}
-		o, exists := td.fieldsNameAndOrder[fName]
+		values, exists := covered[cfi]
 		if ! exists {
-			return 0, errutil.New(ErrInvalidSRTableReference,
-				errutil.MoreInfo, "referenced table does not have referenced field",
-				"value", v)
-		}
-		fi := td.Fields[o]
-		if ! fixed4 && fi.Type != vtInt {
-			return 0, errutil.New(ErrInvalidInt,
-				errutil.MoreInfo, "SRTable reference type mismatch",
-				"value", v,
-				"expected_type", typeString(vtInt),
-				"referenced_type", fi.TypeString() )
-		} else if fixed4 && fi.Type != vtFixed4 {
-			return 0, errutil.New(ErrInvalidInt,
-				errutil.MoreInfo, "SRTable reference type mismatch",
-				"value", v,
-				"expected_type", typeString(vtFixed4),
-				"referenced_type", fi.TypeString() )
+			values = map[int]bool{}
+			covered[cfi] = values
+			fields = append(fields, cfi)
+		}
+		for i := range td.RawData {
+			if fi.Type == vtMap {
+				// keys and values in turn
+				for k := 0; k < len(td.ListData[i][j]); k += 2 {
+					values[td.ListData[i][j][k]] = true
+				}
+			} else if fi.List {
+				for _, v := range td.ListData[i][j] {
+					values[v] = true
+				}
+			} else {
+				values[td.Data[i][j]] = true
+			}
 		}
-		return td.Data[0][o], nil
 	}
 
-	sinfo := proc.st.Find(v)
-	if sinfo != nil {
-		if sinfo.Type != stConst {
-			return 0, errutil.New(ErrInvalidInt,
-				errutil.MoreInfo, "referenced symbol is not const",
-				"value", v)
+	for _, fi := range fields {
+		tNames := []string{}
+		for tName, _ := range fi.KeysOf {
+			tNames = append(tNames, tName)
+		}
+		sort.Strings(tNames)
+		missing := []string{}
+		for _, tName := range tNames {
+			tm := proc.tms[tName]
+			if tm == nil {
+				return errutil.New(ErrUndefinedSymbol,
+					errutil.MoreInfo, "unknown table of " + kwFieldTypeKeysOf,
+					"table", td.Name, "field", fi.Name, "name", tName)
+			}
+			for _, ak := range tm.AutoKeys {
+				if ! covered[fi][ak.Value] {
+					missing = append(missing, ak.Name + " (" + ak.Src + ")")
+				}
+			}
 		}
-		if fixed4 {
-			return 0, errutil.New(ErrInvalidInt,
-				errutil.MoreInfo, "const cannot be used for fixed4 value",
-				"value", v)
+		if len(missing) > 0 {
+			return errutil.New(ErrNotCovered,
+				"table", td.Name, "field", fi.Name,
+				"count", strconv.Itoa(len(missing)),
+				"missing", strings.Join(missing, ", "))
 		}
-		return sinfo.Value, nil
 	}
-
-	return 0, errutil.New(ErrInvalidInt, "value", v)
+	return nil
 }
 
-/////////////////////////////////////////////////////////////////////
-
-func (proc *processor) serializedData() error {
-	time.Sleep(time.Second)
-	proc.logger.Info("generating data...")
+// refTable returns table data of $ref of fi, which must be a table
+// of int keys.
+func (proc *processor) refTable(td *tableData, fi *fieldDef) (*tableData, error) {
+	refTd := proc.tds[fi.Ref]
+	if refTd == nil {
+		return nil, errutil.New(ErrUndefinedSymbol,
+			errutil.MoreInfo, "unknown table of " + kwFieldOptRef,
+			"table", td.Name, "field", fi.Name, "name", fi.Ref)
+	}
+	if refTd.SingleRow || len(refTd.KeyFields) > 0 ||
+		refTd.Fields[0].Type != vtInt {
+		return nil, errutil.New(ErrInvalidFieldDef,
+			errutil.MoreInfo, "table of " + kwFieldOptRef + " must have int keys",
+			"table", td.Name, "field", fi.Name, "ref", fi.Ref)
+	}
+	return refTd, nil
+}
 
-	for tName, tm := range proc.tms {
-		rtdFn := ChangeExt(tm.TmFileName, extResolvedTableData)
-		binFn := binFileName(tName)
-		if NeedToProcess(rtdFn, binFn) {
-			td := proc.tds[tName]
-			err := proc.serializeTableData(tm, td)
+// checkRefs checks if values of $ref fields are keys of the tables.
+// empty values of optional fields are not checked.
+func (proc *processor) checkRefs(td *tableData) error {
+	// table name ==> keys
+	keys := map[string]map[int]bool{}
+	for j, fi := range td.fieldsByOrder {
+		rfi := fi
+		if fi.Type == vtMap {
+			rfi = fi.MapValue
+		}
+		if len(rfi.Ref) == 0 {
+			continue
+		}
+		refKeys, exists := keys[rfi.Ref]
+		if ! exists {
+			refTd, err := proc.refTable(td, rfi)
 			if err != nil {
 				return err
 			}
-			proc.logger.Info("successfully serialized data",
-				"table", tName, "file", binFn)
-		} else {
-			proc.logger.Info("need not generate bin", "table", tName)
+			refKeys = map[int]bool{}
+			for _, intLine := range refTd.Data {
+				refKeys[intLine[0]] = true
+			}
+			keys[rfi.Ref] = refKeys
 		}
-	}
 
-	proc.logger.Info("... finished generating data")
-	return nil
+		for i, line := range td.RawData {
+			values := []int{}
+			if fi.Type == vtMap {
+				// keys and values in turn
+				for k := 1; k < len(td.ListData[i][j]); k += 2 {
+					values = append(values, td.ListData[i][j][k])
+				}
+			} else if fi.List {
+				values = td.ListData[i][j]
+			} else if len(line[j]) > 0 || ! fi.Optional {
+				values = append(values, td.Data[i][j])
+			}
+			for _, v := range values {
+				if ! refKeys[v] {
+					return errutil.New(ErrKeyOutOfRange,
+						"table", td.Name, "field", fi.Name,
+						"value", formatInt(rfi.Type, v),
+						"must_be_keys_of", rfi.Ref,
+						"row_key", td.rowKey(i), "loc", td.RowLoc(i))
+				}
+			}
+		}
+	}
+	return nil
 }
 
-func ser(
-	buf, subbuf *proto.Buffer, fields []*fieldDef, allowSubs bool,
-	intLine []int, strLine []string, i *int) error {
+// checkUnique checks values of $unique fields, and values of
+// fields of table option $unique together.
+func checkUnique(td *tableData) error {
+	// value ==> row
+	for j, fi := range td.fieldsByOrder {
+		if ! fi.Unique {
+			continue
+		}
+		seen := map[string]int{}
+		for i, line := range td.RawData {
+			if len(line[j]) == 0 {
+				continue
+			}
+			v := td.cellValue(i, j)
+			prev, exists := seen[v]
+			if exists {
+				return errutil.New(ErrDuplicateValue,
+					"table", td.Name, "field", fi.Name, "value", line[j],
+					"row_key", td.rowKey(i), "loc", td.RowLoc(i),
+					"prev_row_key", td.rowKey(prev),
+					"prev_loc", td.RowLoc(prev))
+			}
+			seen[v] = i
+		}
+	}
 
-	for _, fi := range fields {
-		if ! allowSubs {
-			if len(fi.Subs) > 0 {
-				return errutil.NewAssert(
-					errutil.MoreInfo, "subtype not allowed",
-					"field", fi.Name)
+	if len(td.UniqueFields) > 0 {
+		cols := make([]int, len(td.UniqueFields))
+		for k, name := range td.UniqueFields {
+			cols[k] = td.fieldsNameAndOrder[name]
+		}
+		seen := map[string]int{}
+		values := make([]string, len(cols))
+		for i, line := range td.RawData {
+			for k, j := range cols {
+				values[k] = td.cellValue(i, j)
 			}
-			if fi.ArrayLen > 0 {
-				return errutil.NewAssert(
-					errutil.MoreInfo, "array not allowed",
-					"field", fi.Name,
-					"array_len", strconv.Itoa(fi.ArrayLen))
+			v := strings.Join(values, "\x00")
+			prev, exists := seen[v]
+			if exists {
+				raw := make([]string, len(cols))
+				for k, j := range cols {
+					raw[k] = line[j]
+				}
+				return errutil.New(ErrDuplicateValue,
+					errutil.MoreInfo, "duplicate in " + kwTblOptUnique,
+					"table", td.Name,
+					"fields", strings.Join(td.UniqueFields, ","),
+					"values", strings.Join(raw, ","),
+					"row_key", td.rowKey(i), "loc", td.RowLoc(i),
+					"prev_row_key", td.rowKey(prev),
+					"prev_loc", td.RowLoc(prev))
+			}
+			seen[v] = i
+		}
+	}
+	return nil
+}
+
+// resolveFieldOpts resolves min and max of the field,
+// and compiles pattern.
+func (proc *processor) resolveFieldOpts(fi *fieldDef) error {
+	var err error
+	if fi.Type == vtMap {
+		return proc.resolveFieldOpts(fi.MapValue)
+	} else if fi.isString() {
+		if len(fi.Pattern) > 0 && fi.rePattern == nil {
+			fi.rePattern, err = compilePattern(fi.Pattern)
+			if err != nil {
+				return errutil.AssertEmbed(err, "opt", kwFieldOptPattern)
+			}
+		}
+	} else if fi.isFloat() {
+		if len(fi.MinStr) > 0 {
+			fi.MinFloat, err = proc.resolveFloat(fi.MinStr, nil)
+			if err != nil {
+				return errutil.AddInfo(err, "opt", kwFieldOptMin)
+			}
+		}
+		if len(fi.MaxStr) > 0 {
+			fi.MaxFloat, err = proc.resolveFloat(fi.MaxStr, nil)
+			if err != nil {
+				return errutil.AddInfo(err, "opt", kwFieldOptMax)
+			}
+		}
+	} else if fi.isTime() {
+		if len(fi.MinStr) > 0 {
+			fi.Min, err = proc.resolveTime(fi.MinStr, fi.Type)
+			if err != nil {
+				return errutil.AddInfo(err, "opt", kwFieldOptMin)
+			}
+		}
+		if len(fi.MaxStr) > 0 {
+			fi.Max, err = proc.resolveTime(fi.MaxStr, fi.Type)
+			if err != nil {
+				return errutil.AddInfo(err, "opt", kwFieldOptMax)
+			}
+		}
+	} else if fi.isInt() {
+		if len(fi.MinStr) > 0 {
+			fi.Min, err = proc.resolveInt(fi.MinStr, fi.Type, nil)
+			if err != nil {
+				return errutil.AddInfo(err, "opt", kwFieldOptMin)
+			}
+		}
+		if len(fi.MaxStr) > 0 {
+			fi.Max, err = proc.resolveInt(fi.MaxStr, fi.Type, nil)
+			if err != nil {
+				return errutil.AddInfo(err, "opt", kwFieldOptMax)
+			}
+		}
+	}
+	return nil
+}
+
+// resolveValue resolves a single value of the field, and checks it
+// against the field opts. string value is not resolved and 0 is returned.
+// empty value is resolved as the default value, if any.
+func (proc *processor) resolveValue(fi *fieldDef, v string) (int, error) {
+	if len(v) == 0 {
+		if fi.Optional {
+			// omitted when serialized
+			return 0, nil
+		}
+		if len(fi.DefaultStr) > 0 {
+			result, err := proc.resolveValue(fi, fi.DefaultStr)
+			if err != nil {
+				return 0, errutil.AddInfo(err, "opt", kwFieldOptDefault)
+			}
+			return result, nil
+		}
+	}
+
+	if fi.Type == vtId {
+		result, srcTable, err := proc.resolveId(v)
+		if err != nil {
+			return 0, err
+		}
+		// check with fi.KeysOf
+		if ! fi.AutoKey && fi.KeysOf != nil {
+			_, exists := fi.KeysOf[srcTable]
+			if ! exists {
+				tbls := []string{}
+				for t, _ := range fi.KeysOf {
+					tbls = append(tbls, t)
+				}
+				return 0, errutil.New(ErrKeyOutOfRange,
+					"value", v,
+					"defined_in", srcTable,
+					"must_be_keys_of", strings.Join(tbls, " "))
+			}
+		}
+		return result, nil
+	} else if fi.isInt() {
+		result, err := proc.resolveInt(v, fi.Type, fi.Units)
+		if err != nil {
+			return 0, err
+		}
+		// check min, max
+		if len(fi.MinStr) > 0 && intLess(fi.Type, result, fi.Min) {
+			return 0, errutil.New(ErrIntOutOfRange,
+				"value", formatInt(fi.Type, result),
+				"raw_value", v,
+				"min", formatInt(fi.Type, fi.Min))
+		}
+		if len(fi.MaxStr) > 0 && intLess(fi.Type, fi.Max, result) {
+			return 0, errutil.New(ErrIntOutOfRange,
+				"value", formatInt(fi.Type, result),
+				"raw_value", v,
+				"max", formatInt(fi.Type, fi.Max))
+		}
+		return result, nil
+	} else if fi.Type == vtBool {
+		return proc.resolveBool(v)
+	} else if fi.Type == vtEnum {
+		return resolveEnum(fi, v)
+	} else if fi.isFloat() {
+		f, err := proc.resolveFloat(v, fi.Units)
+		if err != nil {
+			return 0, err
+		}
+		if fi.Type == vtFloat && math.Abs(f) > math.MaxFloat32 {
+			return 0, errutil.New(ErrFloatOutOfRange,
+				errutil.MoreInfo, "too large for float",
+				"value", v)
+		}
+		if len(fi.MinStr) > 0 && f < fi.MinFloat {
+			return 0, errutil.New(ErrFloatOutOfRange,
+				"value", v, "min", fi.MinStr)
+		}
+		if len(fi.MaxStr) > 0 && f > fi.MaxFloat {
+			return 0, errutil.New(ErrFloatOutOfRange,
+				"value", v, "max", fi.MaxStr)
+		}
+		// float values are kept as bits of float64
+		return int(math.Float64bits(f)), nil
+	} else if fi.isTime() {
+		result, err := proc.resolveTime(v, fi.Type)
+		if err != nil {
+			return 0, err
+		}
+		if len(fi.MinStr) > 0 && result < fi.Min {
+			return 0, errutil.New(ErrTimeOutOfRange,
+				"value", v, "min", fi.MinStr)
+		}
+		if len(fi.MaxStr) > 0 && result > fi.Max {
+			return 0, errutil.New(ErrTimeOutOfRange,
+				"value", v, "max", fi.MaxStr)
+		}
+		return result, nil
+	} else if fi.isString() {
+		// string itself is serialized. only checked.
+		return 0, checkString(fi, v)
+	} else {
+		return 0, errutil.NewAssert(
+			"field", fi.Name,
+			"value_type", fi.TypeString() )
+	}
+}
+
+// checkString checks string value v against nonempty, pattern, and
+// minlen and maxlen, which are numbers of characters. for list,
+// minlen and maxlen are checked by resolveList.
+func checkString(fi *fieldDef, v string) error {
+	if len(v) == 0 {
+		if fi.NonEmpty {
+			return errutil.New(ErrInvalidString,
+				errutil.MoreInfo, "empty value", "opt", kwFieldOptNonEmpty)
+		}
+		// pattern and length are not checked for empty value
+		return nil
+	}
+	if fi.rePattern != nil && ! fi.rePattern.MatchString(v) {
+		return errutil.New(ErrInvalidString,
+			errutil.MoreInfo, "value does not match pattern",
+			"value", v, "pattern", fi.Pattern)
+	}
+	if fi.List {
+		return nil
+	}
+	l := utf8.RuneCountInString(v)
+	if fi.MinLen > 0 && l < fi.MinLen {
+		return errutil.New(ErrInvalidString,
+			errutil.MoreInfo, "too short",
+			"value", v, "len", strconv.Itoa(l),
+			"min_len", strconv.Itoa(fi.MinLen))
+	}
+	if fi.MaxLen > 0 && l > fi.MaxLen {
+		return errutil.New(ErrInvalidString,
+			errutil.MoreInfo, "too long",
+			"value", v, "len", strconv.Itoa(l),
+			"max_len", strconv.Itoa(fi.MaxLen))
+	}
+	return nil
+}
+
+// resolveList resolves each element of list value v.
+func (proc *processor) resolveList(fi *fieldDef, v string) ([]int, error) {
+	elems, err := splitList(v)
+	if err != nil {
+		return nil, err
+	}
+	if fi.MinLen > 0 && len(elems) < fi.MinLen {
+		return nil, errutil.New(ErrInvalidList,
+			errutil.MoreInfo, "too few elements",
+			"value", v, "len", strconv.Itoa(len(elems)),
+			"min_len", strconv.Itoa(fi.MinLen))
+	}
+	if fi.MaxLen > 0 && len(elems) > fi.MaxLen {
+		return nil, errutil.New(ErrInvalidList,
+			errutil.MoreInfo, "too many elements",
+			"value", v, "len", strconv.Itoa(len(elems)),
+			"max_len", strconv.Itoa(fi.MaxLen))
+	}
+	if fi.NonEmpty && len(elems) == 0 {
+		return nil, errutil.New(ErrInvalidList,
+			errutil.MoreInfo, "empty list", "opt", kwFieldOptNonEmpty)
+	}
+	result := make([]int, len(elems))
+	for k, e := range elems {
+		result[k], err = proc.resolveValue(fi, e)
+		if err != nil {
+			return nil, errutil.AddInfo(err,
+				"list_value", v, "index", strconv.Itoa(k))
+		}
+	}
+	return result, nil
+}
+
+func (proc *processor) resolveId(v string) (int, string, error) {
+	sinfo := proc.st.Find(v)
+	if sinfo == nil {
+		return 0, "", errutil.New(ErrUndefinedSymbol, "value", v)
+	}
+	if sinfo.Type != stAutoKey {
+		return 0, "", errutil.New(ErrNotAutoKey,
+			"value", v, "type", typeString(sinfo.Type))
+	}
+
+	return sinfo.Id, sinfo.SrcTable, nil
+}
+
+// resolveInt resolves values of int types, including fixed4.
+// t is the field type, and the result must be in the range of t.
+// uint64 value is kept as its bit pattern.
+func (proc *processor) resolveInt(
+	v string, t int, units map[string]int) (int, error) {
+
+	if len(v) == 0 {
+		return 0, nil
+	}
+	if IsExpression(v) {
+		return proc.resolveIntExpr(v, t, units)
+	}
+	ok, neg, iStr, dStr, unit := DecomposeValue(v)
+	if ok {
+		if len(dStr) > 0 && t != vtFixed4 {
+			return 0, errutil.New(ErrInvalidInt, "value", v)
+		}
+		abs, err := strconv.ParseUint(iStr, 10, 64)
+		if err != nil {
+			return 0, errutil.New(ErrIntOutOfRange,
+				"value", v, "type", typeString(t))
+		}
+		var hi uint64
+		if t == vtFixed4 {
+			// decimal part is scaled to 4 digits. 1.5 is 15000.
+			d, _ := strconv.Atoi((dStr + "0000")[:4])
+			hi, abs = bits.Mul64(abs, Fixed4Mult)
+			if hi != 0 || abs + uint64(d) < abs {
+				return 0, errutil.New(ErrIntOutOfRange,
+					"value", v, "type", typeString(t))
+			}
+			abs += uint64(d)
+		}
+		if len(unit) > 0 {
+			unitMult, exists := units[unit]
+			if ! exists {
+				return 0, errutil.New(ErrInvalidInt,
+					errutil.MoreInfo, "unspecified unit",
+					"unit", unit, "value", v)
+			}
+			if unitMult < 0 {
+				neg = ! neg
+				unitMult = -unitMult
 			}
+			hi, abs = bits.Mul64(abs, uint64(unitMult))
+			if hi != 0 {
+				return 0, errutil.New(ErrIntOutOfRange,
+					"value", v, "type", typeString(t))
+			}
+		}
+		result, ok := intInRange(t, neg, abs)
+		if ! ok {
+			return 0, errutil.New(ErrIntOutOfRange,
+				"value", v, "type", typeString(t))
+		}
+		return result, nil
+	}
+
+	td, row, o, err := proc.referencedCell(v)
+	if err != nil {
+		return 0, err
+	}
+	if td != nil {
+		fi := td.fieldsByOrder[o]
+		if fi.Type != t {
+			return 0, errutil.New(ErrInvalidInt,
+				errutil.MoreInfo, "SRTable reference type mismatch",
+				"value", v,
+				"expected_type", typeString(t),
+				"referenced_type", fi.TypeString() )
+		}
+		return td.Data[row][o], nil
+	}
+
+	sinfo := proc.st.Find(v)
+	if sinfo != nil {
+		if sinfo.Type != stConst {
+			return 0, errutil.New(ErrInvalidInt,
+				errutil.MoreInfo, "referenced symbol is not const",
+				"value", v)
+		}
+		if t == vtFixed4 {
+			return 0, errutil.New(ErrInvalidInt,
+				errutil.MoreInfo, "const cannot be used for fixed4 value",
+				"value", v)
+		}
+		c := sinfo.Value
+		abs := uint64(c)
+		if c < 0 {
+			abs = uint64(-c)
+		}
+		result, ok := intInRange(t, c < 0, abs)
+		if ! ok {
+			return 0, errutil.New(ErrIntOutOfRange,
+				"value", v, "const_value", strconv.Itoa(c),
+				"type", typeString(t))
+		}
+		return result, nil
+	}
+
+	return 0, errutil.New(ErrInvalidInt, "value", v)
+}
+
+// intInRange returns the value with the given sign and absolute value,
+// if it is in the range of t.
+func intInRange(t int, neg bool, abs uint64) (int, bool) {
+	// max absolute values of negative and positive values
+	var negMax, posMax uint64
+	switch t {
+	case vtInt, vtFixed4:
+		negMax, posMax = -math.MinInt32, math.MaxInt32
+	case vtInt64:
+		negMax, posMax = 1<<63, math.MaxInt64
+	case vtUint32:
+		negMax, posMax = 0, math.MaxUint32
+	case vtUint64:
+		negMax, posMax = 0, math.MaxUint64
+	default:
+		return 0, false
+	}
+	if neg {
+		if abs > negMax {
+			return 0, false
+		}
+		return int(-abs), true
+	}
+	if abs > posMax {
+		return 0, false
+	}
+	return int(abs), true
+}
+
+// intLess compares two resolved values of int type t.
+func intLess(t int, a, b int) bool {
+	if t == vtUint64 {
+		return uint64(a) < uint64(b)
+	}
+	return a < b
+}
+
+func formatInt(t int, v int) string {
+	if t == vtUint64 {
+		return strconv.FormatUint(uint64(v), 10)
+	}
+	return strconv.Itoa(v)
+}
+
+// referencedCell returns table data, row and column of v, which is
+// either Table.field of single-row table, or Table[RowKey].field of
+// a row of multi-row table. nil is returned if v is not a reference.
+func (proc *processor) referencedCell(v string) (*tableData, int, int, error) {
+	tName, rowKey, fName := DecomposeRowReference(v)
+	if len(tName) == 0 {
+		tName, fName = DecomposeSRTableReference(v)
+		if len(tName) == 0 {
+			return nil, 0, 0, nil
+		}
+	}
+	td, exists := proc.tds[tName]
+	if ! exists {
+		return nil, 0, 0, errutil.NewAssert("table", tName, "value", v)
+	}
+	row := 0
+	if len(rowKey) == 0 {
+		if ! td.SingleRow {
+			return nil, 0, 0, errutil.New(ErrInvalidSRTableReference,
+				errutil.MoreInfo, "referenced table is not single-row",
+				"value", v)
+		}
+	} else {
+		if td.SingleRow {
+			return nil, 0, 0, errutil.New(ErrInvalidSRTableReference,
+				errutil.MoreInfo, "referenced table is single-row",
+				"value", v)
 		}
+		if len(td.KeyFields) > 0 {
+			return nil, 0, 0, errutil.New(ErrInvalidSRTableReference,
+				errutil.MoreInfo, "referenced table has composite key",
+				"value", v)
+		}
+		var err error
+		row, err = proc.findRow(td, rowKey)
+		if err != nil {
+			return nil, 0, 0, errutil.AddInfo(err, "value", v)
+		}
+	}
+	o, exists := td.fieldsNameAndOrder[fName]
+	if ! exists {
+		return nil, 0, 0, errutil.New(ErrInvalidSRTableReference,
+			errutil.MoreInfo, "referenced table does not have referenced field",
+			"value", v)
+	}
+	if td.fieldsByOrder[o].List {
+		return nil, 0, 0, errutil.New(ErrInvalidSRTableReference,
+			errutil.MoreInfo, "referenced field is " + kwFieldOptList,
+			"value", v)
+	}
+	return td, row, o, nil
+}
 
+// findRow returns the row of td whose key is rowKey, which is
+// an autokey or id for the table of id keys, or int.
+func (proc *processor) findRow(td *tableData, rowKey string) (int, error) {
+	var key int
+	var err error
+	if td.Fields[0].Type == vtId {
+		key, _, err = proc.resolveId(rowKey)
+	} else {
+		key, err = proc.resolveInt(rowKey, vtInt, nil)
+	}
+	if err != nil {
+		return 0, errutil.AddInfo(err, "row_key", rowKey)
+	}
+	for i, intLine := range td.Data {
+		if intLine[0] == key {
+			return i, nil
+		}
+	}
+	return 0, errutil.New(ErrInvalidSRTableReference,
+		errutil.MoreInfo, "referenced row does not exist",
+		"table", td.Name, "row_key", rowKey)
+}
+
+// resolveBool returns 1 for true, 0 for false.
+// TRUE/FALSE in any case, 1/0, and excel's boolean cells are accepted.
+// empty value is false.
+func (proc *processor) resolveBool(v string) (int, error) {
+	switch strings.ToLower(v) {
+	case "", "false", "0":
+		return 0, nil
+	case "true", "1":
+		return 1, nil
+	}
+
+	td, row, o, err := proc.referencedCell(v)
+	if err != nil {
+		return 0, err
+	}
+	if td != nil {
+		fi := td.fieldsByOrder[o]
+		if fi.Type != vtBool {
+			return 0, errutil.New(ErrInvalidBool,
+				errutil.MoreInfo, "SRTable reference type mismatch",
+				"value", v,
+				"expected_type", typeString(vtBool),
+				"referenced_type", fi.TypeString() )
+		}
+		return td.Data[row][o], nil
+	}
+
+	return 0, errutil.New(ErrInvalidBool, "value", v)
+}
+
+// resolveFloat resolves both float and double values.
+// int consts and SRTable references to float or double fields are allowed.
+func (proc *processor) resolveFloat(
+	v string, units map[string]int) (float64, error) {
+
+	if len(v) == 0 {
+		return 0, nil
+	}
+	if IsExpression(v) {
+		return proc.resolveFloatExpr(v, units)
+	}
+	ok, f, unit := DecomposeFloatValue(v)
+	if ok {
+		if len(unit) > 0 {
+			unitMult, exists := units[unit]
+			if ! exists {
+				return 0, errutil.New(ErrInvalidFloat,
+					errutil.MoreInfo, "unspecified unit",
+					"unit", unit, "value", v)
+			}
+			f *= float64(unitMult)
+		}
+		return f, nil
+	}
+
+	td, row, o, err := proc.referencedCell(v)
+	if err != nil {
+		return 0, err
+	}
+	if td != nil {
+		fi := td.fieldsByOrder[o]
+		if ! fi.isFloat() {
+			return 0, errutil.New(ErrInvalidFloat,
+				errutil.MoreInfo, "SRTable reference type mismatch",
+				"value", v,
+				"expected_type", typeString(vtFloat) + " or " + typeString(vtDouble),
+				"referenced_type", fi.TypeString() )
+		}
+		return math.Float64frombits(uint64(td.Data[row][o])), nil
+	}
+
+	sinfo := proc.st.Find(v)
+	if sinfo != nil {
+		if sinfo.Type != stConst {
+			return 0, errutil.New(ErrInvalidFloat,
+				errutil.MoreInfo, "referenced symbol is not const",
+				"value", v)
+		}
+		return float64(sinfo.Value), nil
+	}
+
+	return 0, errutil.New(ErrInvalidFloat, "value", v)
+}
+
+// resolveTime resolves duration and datetime values as milliseconds.
+// SRTable references to fields of the same type are allowed.
+// empty value is 0.
+func (proc *processor) resolveTime(v string, t int) (int, error) {
+	if len(v) == 0 {
+		return 0, nil
+	}
+
+	td, row, o, err := proc.referencedCell(v)
+	if err != nil {
+		return 0, err
+	}
+	if td != nil {
+		fi := td.fieldsByOrder[o]
+		if fi.Type != t {
+			return 0, errutil.New(ErrInvalidSRTableReference,
+				errutil.MoreInfo, "SRTable reference type mismatch",
+				"value", v,
+				"expected_type", typeString(t),
+				"referenced_type", fi.TypeString() )
+		}
+		return td.Data[row][o], nil
+	}
+
+	if t == vtDuration {
+		return ParseDuration(v)
+	}
+	return ParseDatetime(v, proc.config.location)
+}
+
+// resolveEnum returns the value of the enum name v.
+// for const group, the full const name is also accepted.
+// empty value is not allowed, unless $optional or $default is given.
+func resolveEnum(fi *fieldDef, v string) (int, error) {
+	if len(v) == 0 {
+		return 0, errutil.New(ErrInvalidEnum,
+			errutil.MoreInfo, "value is required. use " +
+				kwFieldOptOptional + " or " + kwFieldOptDefault,
+			"allowed", strings.Join(fi.EnumNames, " "))
+	}
+	if len(fi.EnumGroup) > 0 {
+		v = strings.TrimPrefix(v, fi.EnumGroup + "_")
+	}
+	for i, name := range fi.EnumNames {
+		if name == v {
+			return fi.EnumValues[i], nil
+		}
+	}
+	return 0, errutil.New(ErrInvalidEnum,
+		"value", v, "allowed", strings.Join(fi.EnumNames, " "))
+}
+
+// resolveMap resolves keys and values of map value v,
+// and returns them as key, value, key, value, ...
+func (proc *processor) resolveMap(fi *fieldDef, v string) ([]int, error) {
+	keys, values, err := splitMap(v)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]int, 0, 2*len(keys))
+	resolvedKeys := map[string]string{}
+	for k, key := range keys {
+		kv, err := proc.resolveValue(fi.MapKey, key)
+		if err != nil {
+			return nil, errutil.AddInfo(err, "map_value", v, "map_key", key)
+		}
+		// compare resolved keys, since different names can be the same key
+		rk := key
+		if fi.MapKey.Type != vtString {
+			rk = strconv.Itoa(kv)
+		}
+		prev, exists := resolvedKeys[rk]
+		if exists {
+			return nil, errutil.New(ErrInvalidMap,
+				errutil.MoreInfo, "duplicate key",
+				"map_key", key, "prev_map_key", prev, "value", v)
+		}
+		resolvedKeys[rk] = key
+		vv, err := proc.resolveValue(fi.MapValue, values[k])
+		if err != nil {
+			return nil, errutil.AddInfo(err, "map_value", v, "map_key", key)
+		}
+		result = append(result, kv, vv)
+	}
+	return result, nil
+}
+
+/////////////////////////////////////////////////////////////////////
+
+func (proc *processor) serializedData() error {
+	time.Sleep(time.Second)
+	proc.logger.Info("generating data...")
+
+	for tName, tm := range proc.tms {
+		rtdFn := ChangeExt(tm.TmFileName, extResolvedTableData)
+		binFn := binFileName(tName)
+		if NeedToProcess(rtdFn, binFn) {
+			td := proc.tds[tName]
+			err := proc.serializeTableData(tm, td)
+			if err != nil {
+				return err
+			}
+			proc.logger.Info("successfully serialized data",
+				"table", tName, "file", binFn)
+		} else {
+			proc.logger.Info("need not generate bin", "table", tName)
+		}
+	}
+
+	proc.logger.Info("... finished generating data")
+	return nil
+}
+
+// ser serializes fields of a row, from the i-th column.
+// listLine is nil if the table has no list field.
+func ser(
+	buf *proto.Buffer, fields []*fieldDef,
+	intLine []int, strLine []string, listLine [][]int, i *int) error {
+
+	var subbuf *proto.Buffer
+	for _, fi := range fields {
 		if len(fi.Subs) > 0 {
+			if subbuf == nil {
+				subbuf = proto.NewBuffer(nil)
+			}
 			count := 1
 			if fi.ArrayLen > 0 {
 				count = fi.ArrayLen
@@ -1475,8 +2382,7 @@ func ser(
 				if err != nil {
 					return err
 				}
-				err = ser(subbuf, nil, fi.Subs, false,
-					intLine, strLine, i)
+				err = ser(subbuf, fi.Subs, intLine, strLine, listLine, i)
 				if err != nil {
 					return err
 				}
@@ -1486,57 +2392,178 @@ func ser(
 				}
 				subbuf.Reset()
 			}
-		} else if fi.Type == vtId || fi.Type == vtInt || fi.Type == vtFixed4 {
-			err := buf.EncodeVarint(fi.ProtoKey)
+			continue
+		}
+
+		if fi.Type == vtMap {
+			if listLine == nil {
+				return errutil.NewAssert(
+					errutil.MoreInfo, "no map data", "field", fi.Name)
+			}
+			// already checked when resolved
+			keys, values, _ := splitMap(strLine[*i])
+			for k := range values {
+				values[k] = fi.MapValue.rawValue(values[k])
+			}
+			err := serMap(buf, fi, listLine[*i], keys, values)
 			if err != nil {
 				return err
 			}
-			if fi.ArrayLen > 0 {
-				err := buf.EncodeVarint(uint64(fi.ArrayLen))
-				if err != nil {
-					return err
-				}
-				for j := 0; j < fi.ArrayLen; j++ {
-					err = buf.EncodeVarint(uint64(intLine[*i]))
-					if err != nil {
-						return err
-					}
-					*i++
-				}
+			*i++
+			continue
+		}
+
+		if fi.Optional && len(strLine[*i]) == 0 {
+			*i++
+			continue
+		}
+
+		var ints []int
+		var strs []string
+		if fi.List {
+			if listLine == nil {
+				return errutil.NewAssert(
+					errutil.MoreInfo, "no list data", "field", fi.Name)
+			}
+			ints = listLine[*i]
+			if fi.Type == vtString || fi.Type == vtText {
+				// already checked when resolved
+				strs, _ = splitList(strLine[*i])
 			} else {
-				err = buf.EncodeVarint(uint64(intLine[*i]))
-				if err != nil {
-					return err
-				}
-				*i++
+				strs = make([]string, len(ints))
 			}
-		} else if fi.Type == vtString {
+			*i++
+		} else {
 			count := 1
 			if fi.ArrayLen > 0 {
 				count = fi.ArrayLen
 			}
-			for j := 0; j < count; j++ {
-				err := buf.EncodeVarint(fi.ProtoKey)
+			ints = intLine[*i : *i+count]
+			strs = make([]string, count)
+			for j := range strs {
+				strs[j] = fi.rawValue(strLine[*i+j])
+			}
+			*i += count
+		}
+		err := serValues(buf, fi, ints, strs)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// serValues encodes values of a non-sub field with key.
+// repeated values are packed, except for strings.
+func serValues(buf *proto.Buffer, fi *fieldDef, ints []int, strs []string) error {
+	wt := fi.wireType()
+	if wt == proto.WireBytes {
+		for j := range ints {
+			err := buf.EncodeVarint(fi.ProtoKey)
+			if err != nil {
+				return err
+			}
+			err = serValue(buf, fi, ints[j], strs[j])
+			if err != nil {
+				return err
+			}
+		}
+	} else if wt >= 0 {
+		if fi.repeated() {
+			if len(ints) == 0 {
+				return nil
+			}
+			// packed
+			packed := proto.NewBuffer(nil)
+			for j := range ints {
+				err := serValue(packed, fi, ints[j], strs[j])
 				if err != nil {
 					return err
 				}
-				for j := 0; j < count; j++ {
-					err = buf.EncodeRawBytes([]byte(strLine[*i]))
-					if err != nil {
-						return err
-					}
-					*i++
-				}
 			}
-		} else {
-			return errutil.NewAssert(
-				"field", fi.Name, "type", fi.TypeString() )
+			err := buf.EncodeVarint(fi.ProtoKey)
+			if err != nil {
+				return err
+			}
+			return buf.EncodeRawBytes(packed.Bytes())
+		}
+		err := buf.EncodeVarint(fi.ProtoKey)
+		if err != nil {
+			return err
 		}
+		return serValue(buf, fi, ints[0], strs[0])
+	} else {
+		return errutil.NewAssert(
+			"field", fi.Name, "type", fi.TypeString() )
 	}
+	return nil
+}
 
+// serMap encodes each entry of map as a message of key and value.
+func serMap(buf *proto.Buffer, fi *fieldDef,
+	ints []int, keys, values []string) error {
+
+	entry := proto.NewBuffer(nil)
+	for k := range keys {
+		entry.Reset()
+		err := serValues(entry, fi.MapKey, ints[2*k:2*k+1], keys[k:k+1])
+		if err != nil {
+			return err
+		}
+		err = serValues(entry, fi.MapValue, ints[2*k+1:2*k+2], values[k:k+1])
+		if err != nil {
+			return err
+		}
+		err = buf.EncodeVarint(fi.ProtoKey)
+		if err != nil {
+			return err
+		}
+		err = buf.EncodeRawBytes(entry.Bytes())
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// serValue encodes a single value of the field, without key.
+func serValue(buf *proto.Buffer, fi *fieldDef, iv int, sv string) error {
+	if fi.ZigZag {
+		if fi.Type == vtInt64 {
+			return buf.EncodeZigzag64(uint64(iv))
+		}
+		return buf.EncodeZigzag32(uint64(iv))
+	}
+	switch fi.Type {
+	case vtId, vtInt, vtFixed4, vtBool, vtInt64, vtUint32, vtUint64, vtEnum:
+		return buf.EncodeVarint(uint64(iv))
+	case vtString, vtText:
+		return buf.EncodeStringBytes(sv)
+	case vtFloat:
+		f := math.Float64frombits(uint64(iv))
+		return buf.EncodeFixed32(uint64(math.Float32bits(float32(f))))
+	case vtDouble:
+		return buf.EncodeFixed64(uint64(iv))
+	case vtDuration, vtDatetime:
+		// google.protobuf.Duration or Timestamp
+		sec, nanos := timeMessage(fi.Type, iv)
+		msg := proto.NewBuffer(nil)
+		if sec != 0 {
+			msg.EncodeVarint(uint64(1)<<3 | proto.WireVarint)
+			msg.EncodeVarint(uint64(sec))
+		}
+		if nanos != 0 {
+			msg.EncodeVarint(uint64(2)<<3 | proto.WireVarint)
+			msg.EncodeVarint(uint64(nanos))
+		}
+		return buf.EncodeRawBytes(msg.Bytes())
+	default:
+		return errutil.NewAssert(
+			"field", fi.Name, "type", fi.TypeString() )
+	}
+}
+
 func (proc *processor) serializeTableData(tm *tableMeta, td *tableData) error {
 	binFn := binFileName(tm.Name)
 	binF, err := os.Create(binFn)
@@ -1544,17 +2571,29 @@ func (proc *processor) serializeTableData(tm *tableMeta, td *tableData) error {
 		return errutil.AddInfo(err, "table", tm.Name)
 	}
 	pb := proto.NewBuffer(nil)
-	subpb := proto.NewBuffer(nil)
-	for row, intLine := range td.Data {
-		strLine := td.RawData[row]
-		err = pb.EncodeVarint( uint64(1)<<3 | proto.WireBytes )
+	rowpb := proto.NewBuffer(nil)
+	// texts are serialized as their keys
+	lines, _ := td.textLines()
+	for _, row := range td.rowOrder() {
+		intLine := td.Data[row]
+		strLine := lines[row]
+		var listLine [][]int
+		if td.ListData != nil {
+			listLine = td.ListData[row]
+		}
+		col := 0
+		err = ser(rowpb, tm.Fields, intLine, strLine, listLine, &col)
 		if err != nil {
 			os.Remove(binFn)
 			return errutil.AddInfo(err,
 				"table", tm.Name, "row", strconv.Itoa(row))
 		}
-		col := 0
-		err = ser(pb, subpb, tm.Fields, true, intLine, strLine, &col)
+		// each row is an element of repeated data = 1
+		err = pb.EncodeVarint( uint64(1)<<3 | proto.WireBytes )
+		if err == nil {
+			err = pb.EncodeRawBytes(rowpb.Bytes())
+		}
+		rowpb.Reset()
 		if err != nil {
 			os.Remove(binFn)
 			return errutil.AddInfo(err,
@@ -1611,6 +2650,10 @@ func (proc *processor) writeProtos() error {
 		}
 		proc.protoFns = append(proc.protoFns, protoFn)
 	}
+	err := proc.writeTextProto()
+	if err != nil {
+		return err
+	}
 
 	proc.logger.Info("...finished creating proto files...")
 	return nil
@@ -1618,19 +2661,13 @@ func (proc *processor) writeProtos() error {
 const protoTmplStr = `
 {{- "syntax = "}}"proto3";
 package {{ protoPackage }};
+{{- range .ProtoImports }}
+import "{{.}}";
+{{- end }}
 
 message {{ protoTypePrefix }}{{.Name}} {{- " {\n" }}
 {{- range .Fields}}
-    {{- if .Subs}}
-    	{{- "    message"}} {{.ProtoType}} {{- " {\n" }}
- 	    {{- range .Subs}}
-			{{- "        "}}
-			{{- .ProtoLine }}
-        {{- end}}
-        {{- "    }\n" }}
-    {{- end}}
-	{{- "    "}}
-	{{- .ProtoLine }}
+	{{- .ProtoDef "    " }}
 {{- end}}
 {{- "}" }}
 
@@ -1655,7 +2692,8 @@ func (proc *processor) compileProtos() error {
 		}
 	}
 	if needToProcess {
-		args := []string{"-o" + descFn }
+		// imports such as google/protobuf/duration.proto are included
+		args := []string{"-o" + descFn, "--include_imports" }
 		args = append(args, proc.protoFns...)
 		cmd := exec.Command(proc.config.Protoc, args...)
 		out, err := cmd.CombinedOutput()
@@ -1777,8 +2815,11 @@ func (proc *processor) generateSrcFiles() error {
 		}
 		if needToProcess {
 			// generate loader file
-
-			proc.logger.Info("generated loader src file", "file", loaderFn)
+			err := proc.writeLoader(loaderFn, goLoaderTmplStr, goName, goParam)
+			if err != nil {
+				os.Remove(loaderFn)
+				return err
+			}
 		}
 	}
 
@@ -1829,8 +2870,11 @@ func (proc *processor) generateSrcFiles() error {
 		}
 		if needToProcess {
 			// generate loader file
-
-			proc.logger.Info("generated loader src file", "file", loaderFn)
+			err := proc.writeLoader(loaderFn, csLoaderTmplStr, csName, csParam)
+			if err != nil {
+				os.Remove(loaderFn)
+				return err
+			}
 		}
 	}
 
@@ -0,0 +1,940 @@
+package nparamcli
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// newTestProcessor returns a processor with consts, for resolving values.
+func newTestProcessor(t *testing.T, consts map[string]int) *processor {
+	t.Helper()
+	proc := &processor{
+		st: &symbolTable{
+			name2Id: map[string]int{},
+			byName:  map[string]*symbolInfo{},
+		},
+		tms: map[string]*tableMeta{},
+		tds: map[string]*tableData{},
+	}
+	id := 1
+	for name, value := range consts {
+		proc.st.AddIds(map[string]int{ name: id })
+		_, err := proc.st.AddNewSymbol(name, "test", "", stConst, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id++
+	}
+	return proc
+}
+
+func TestResolveInt(t *testing.T) {
+	proc := newTestProcessor(t, map[string]int{
+		"Big": math.MaxInt32 + 1,
+		"Neg": -1,
+	})
+	units := map[string]int{ "k": 1000, "M": 1000000, "down": -1 }
+	tests := []struct {
+		v     string
+		typ   int
+		want  int
+		err   error
+	}{
+		{ "", vtInt, 0, nil },
+		{ "-5", vtInt, -5, nil },
+		{ "+5", vtInt, 5, nil },
+		{ "2147483647", vtInt, math.MaxInt32, nil },
+		{ "2147483648", vtInt, 0, ErrIntOutOfRange },
+		{ "-2147483648", vtInt, math.MinInt32, nil },
+		{ "-2147483649", vtInt, 0, ErrIntOutOfRange },
+		{ "1.5", vtInt, 0, ErrInvalidInt },
+		{ "9223372036854775807", vtInt64, math.MaxInt64, nil },
+		{ "9223372036854775808", vtInt64, 0, ErrIntOutOfRange },
+		{ "-9223372036854775808", vtInt64, math.MinInt64, nil },
+		{ "-9223372036854775809", vtInt64, 0, ErrIntOutOfRange },
+		{ "4294967295", vtUint32, math.MaxUint32, nil },
+		{ "4294967296", vtUint32, 0, ErrIntOutOfRange },
+		{ "-1", vtUint32, 0, ErrIntOutOfRange },
+		{ "0", vtUint32, 0, nil },
+		{ "18446744073709551615", vtUint64, -1, nil },
+		{ "18446744073709551616", vtUint64, 0, ErrIntOutOfRange },
+		{ "-1", vtUint64, 0, ErrIntOutOfRange },
+		{ "3k", vtInt, 3000, nil },
+		{ "3 k", vtInt, 3000, nil },
+		{ "2147k", vtInt, 2147000, nil },
+		{ "2148M", vtInt, 0, ErrIntOutOfRange },
+		{ "2148M", vtInt64, 2148000000, nil },
+		{ "5down", vtInt, -5, nil },
+		{ "1down", vtUint32, 0, ErrIntOutOfRange },
+		{ "18446744073709551615k", vtUint64, 0, ErrIntOutOfRange },
+		{ "3x", vtInt, 0, ErrInvalidInt },
+		{ "1.5", vtFixed4, 15000, nil },
+		{ "-0.0001", vtFixed4, -1, nil },
+		{ "1.5k", vtFixed4, 15000000, nil },
+		{ "214748.3647", vtFixed4, math.MaxInt32, nil },
+		{ "214748.3648", vtFixed4, 0, ErrIntOutOfRange },
+		{ "Big", vtInt, 0, ErrIntOutOfRange },
+		{ "Big", vtInt64, math.MaxInt32 + 1, nil },
+		{ "Neg", vtInt, -1, nil },
+		{ "Neg", vtUint32, 0, ErrIntOutOfRange },
+		{ "Neg", vtFixed4, 0, ErrInvalidInt },
+		{ "Unknown", vtInt, 0, ErrInvalidInt },
+	}
+	for _, tt := range tests {
+		got, err := proc.resolveInt(tt.v, tt.typ, units)
+		if tt.err != nil {
+			if err == nil || ! strings.Contains(err.Error(), tt.err.Error()) {
+				t.Errorf("resolveInt(%q, %s): error %v, want %v",
+					tt.v, typeString(tt.typ), err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("resolveInt(%q, %s): %v", tt.v, typeString(tt.typ), err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("resolveInt(%q, %s) = %d, want %d",
+				tt.v, typeString(tt.typ), got, tt.want)
+		}
+	}
+}
+
+func TestResolveEnum(t *testing.T) {
+	fi := &fieldDef{
+		Name: "color", Type: vtEnum, EnumGroup: "Color",
+		EnumNames: []string{ "Red", "Blue" }, EnumValues: []int{ 1, 5 },
+	}
+	tests := []struct {
+		v     string
+		want  int
+		err   error
+	}{
+		{ "Red", 1, nil },
+		{ "Blue", 5, nil },
+		{ "Color_Blue", 5, nil },
+		{ "Green", 0, ErrInvalidEnum },
+		{ "", 0, ErrInvalidEnum },
+	}
+	for _, tt := range tests {
+		got, err := resolveEnum(fi, tt.v)
+		if tt.err != nil {
+			if err == nil || ! strings.Contains(err.Error(), tt.err.Error()) {
+				t.Errorf("resolveEnum(%q): error %v, want %v", tt.v, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("resolveEnum(%q) = %d, %v, want %d", tt.v, got, err, tt.want)
+		}
+	}
+}
+
+// testPbField is an expected field of serialized message.
+type testPbField struct {
+	tag    uint64
+	wt     uint64
+	// varint, fixed32 and fixed64
+	raw    uint64
+	// bytes
+	data   string
+	// packed repeated, decoded by dec. DecodeVarint if dec is nil.
+	packed []uint64
+	dec    func(*proto.Buffer) (uint64, error)
+	// embedded message
+	sub    []testPbField
+}
+
+// checkTestPb decodes b, and checks that its fields are want, in order.
+func checkTestPb(t *testing.T, path string, b []byte, want []testPbField) {
+	t.Helper()
+	buf := proto.NewBuffer(b)
+	for i, w := range want {
+		p := fmt.Sprintf("%s[%d]", path, i)
+		if len(buf.Unread()) == 0 {
+			t.Errorf("%s: missing field %d", p, w.tag)
+			return
+		}
+		key, err := buf.DecodeVarint()
+		if err != nil {
+			t.Fatalf("%s: %v", p, err)
+		}
+		if key>>3 != w.tag || key&7 != w.wt {
+			t.Fatalf("%s: field %d wire type %d, want %d %d",
+				p, key>>3, key&7, w.tag, w.wt)
+		}
+		var v uint64
+		switch w.wt {
+		case proto.WireVarint:
+			v, err = buf.DecodeVarint()
+		case proto.WireFixed32:
+			v, err = buf.DecodeFixed32()
+		case proto.WireFixed64:
+			v, err = buf.DecodeFixed64()
+		case proto.WireBytes:
+			var d []byte
+			d, err = buf.DecodeRawBytes(true)
+			if err != nil {
+				break
+			}
+			if w.sub != nil {
+				checkTestPb(t, p, d, w.sub)
+			} else if w.packed != nil {
+				checkTestPacked(t, p, d, w.packed, w.dec)
+			} else if string(d) != w.data {
+				t.Errorf("%s: %q, want %q", p, d, w.data)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", p, err)
+		}
+		if v != w.raw {
+			t.Errorf("%s: %#x, want %#x", p, v, w.raw)
+		}
+	}
+	if len(buf.Unread()) > 0 {
+		t.Errorf("%s: %d bytes left", path, len(buf.Unread()))
+	}
+}
+
+func checkTestPacked(t *testing.T, path string, d []byte,
+	want []uint64, dec func(*proto.Buffer) (uint64, error)) {
+
+	t.Helper()
+	if dec == nil {
+		dec = (*proto.Buffer).DecodeVarint
+	}
+	buf := proto.NewBuffer(d)
+	got := []uint64{}
+	for len(buf.Unread()) > 0 {
+		v, err := dec(buf)
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		got = append(got, v)
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("%s: packed %#x, want %#x", path, got, want)
+	}
+}
+
+// setTestProtoKeys sets tags of the fields in order, from 1.
+func setTestProtoKeys(t *testing.T, fields []*fieldDef) {
+	t.Helper()
+	for i, fi := range fields {
+		fi.symbolInfo = &symbolInfo{ Name: fi.Name, Value: i+1 }
+		err := fi.SetProtoKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		setTestProtoKeys(t, fi.Subs)
+	}
+}
+
+// serializeTestTable serializes td in a temp dir, and returns .pb.bin.
+func serializeTestTable(t *testing.T, tm *tableMeta, td *tableData) []byte {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chdir(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	err = initPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proc := &processor{}
+	err = proc.serializeTableData(tm, td)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(binFileName(tm.Name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestSerializeTableData(t *testing.T) {
+	tOpts, err := GetTableOpts("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tm, err := BuildTableMeta("T", "test", "", tOpts,
+		[]string{ "id", "n", "b", "s", "v[0]", "v[1]", "v[2]", "t[0]", "t[1]",
+			"p[0].x", "p[0].y", "p[1].x", "p[1].y" },
+		[]string{ "$autokey", "$int", "$bool", "$string", "$int", "$int", "$int",
+			"$string", "$string", "$int", "$string", "$int", "$string" })
+	if err != nil {
+		t.Fatal(err)
+	}
+	setTestProtoKeys(t, tm.Fields)
+	td := &tableData{
+		Name:      "T",
+		tableMeta: tm,
+		RawData:   [][]string{
+			{ "A", "-5", "TRUE", "hi", "1", "300", "-1", "x", "", "7", "q", "0", "" },
+			{ "B", "0", "", "", "0", "0", "0", "", "", "0", "", "0", "" },
+		},
+		Data:      [][]int{
+			{ 1, -5, 1, 0, 1, 300, -1, 0, 0, 7, 0, 0, 0 },
+			{ 2, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0 },
+		},
+	}
+
+	b := serializeTestTable(t, tm, td)
+	// negative int is a 10-byte varint, as int32 of proto
+	row := func(id, n, bo uint64, s string, v []uint64, t0 string,
+		p0x uint64, p0y string) []testPbField {
+		return []testPbField{
+			{ tag: 1, wt: proto.WireVarint, raw: id },
+			{ tag: 2, wt: proto.WireVarint, raw: n },
+			{ tag: 3, wt: proto.WireVarint, raw: bo },
+			{ tag: 4, wt: proto.WireBytes, data: s },
+			{ tag: 5, wt: proto.WireBytes, packed: v },
+			{ tag: 6, wt: proto.WireBytes, data: t0 },
+			{ tag: 6, wt: proto.WireBytes, data: "" },
+			{ tag: 7, wt: proto.WireBytes, sub: []testPbField{
+				{ tag: 1, wt: proto.WireVarint, raw: p0x },
+				{ tag: 2, wt: proto.WireBytes, data: p0y },
+			} },
+			{ tag: 7, wt: proto.WireBytes, sub: []testPbField{
+				{ tag: 1, wt: proto.WireVarint, raw: 0 },
+				{ tag: 2, wt: proto.WireBytes, data: "" },
+			} },
+		}
+	}
+	neg := func(v int64) uint64 { return uint64(v) }
+	checkTestPb(t, "T", b, []testPbField{
+		{ tag: 1, wt: proto.WireBytes,
+			sub: row(1, neg(-5), 1, "hi", []uint64{ 1, 300, neg(-1) }, "x", 7, "q") },
+		{ tag: 1, wt: proto.WireBytes,
+			sub: row(2, 0, 0, "", []uint64{ 0, 0, 0 }, "", 0, "") },
+	})
+
+	// packed layout: length, then varints without keys
+	r := proto.NewBuffer(b)
+	r.DecodeVarint()
+	rb, _ := r.DecodeRawBytes(false)
+	want := []byte{ 0x2a, 13, 0x01, 0xac, 0x02,
+		0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01 }
+	if ! bytes.Contains(rb, want) {
+		t.Errorf("packed v not found in %x", rb)
+	}
+}
+
+func TestSerializeFloats(t *testing.T) {
+	tOpts, err := GetTableOpts("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newTm := func() *tableMeta {
+		tm, err := BuildTableMeta("T", "test", "", tOpts,
+			[]string{ "id", "f", "d", "fa[0]", "fa[1]", "da[0]", "da[1]" },
+			[]string{ "$int", "$float", "$double", "$float", "$float",
+				"$double", "$double" })
+		if err != nil {
+			t.Fatal(err)
+		}
+		setTestProtoKeys(t, tm.Fields)
+		return tm
+	}
+	proc := newTestProcessor(t, nil)
+
+	tm := newTm()
+	td := &tableData{
+		Name:      "T",
+		tableMeta: tm,
+		RawData:   [][]string{
+			{ "1", "-1.5", "-1.5", "-0", "3.4028234663852886e38", "-0", "1e308" },
+			{ "2", "1.401298464324817e-45", "5e-324",
+				"-3.4028234663852886e38", "0.1", "0.1", "-2.5e-3" },
+		},
+	}
+	err = proc.resolveTd(td)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := serializeTestTable(t, tm, td)
+	// single values are fixed32 and fixed64, arrays are packed of them
+	checkTestPb(t, "T", b, []testPbField{
+		{ tag: 1, wt: proto.WireBytes, sub: []testPbField{
+			{ tag: 1, wt: proto.WireVarint, raw: 1 },
+			{ tag: 2, wt: proto.WireFixed32, raw: 0xbfc00000 },
+			{ tag: 3, wt: proto.WireFixed64, raw: 0xbff8000000000000 },
+			{ tag: 4, wt: proto.WireBytes,
+				packed: []uint64{ 0x80000000, 0x7f7fffff },
+				dec: (*proto.Buffer).DecodeFixed32 },
+			{ tag: 5, wt: proto.WireBytes,
+				packed: []uint64{ 0x8000000000000000, 0x7fe1ccf385ebc8a0 },
+				dec: (*proto.Buffer).DecodeFixed64 },
+		} },
+		{ tag: 1, wt: proto.WireBytes, sub: []testPbField{
+			{ tag: 1, wt: proto.WireVarint, raw: 2 },
+			{ tag: 2, wt: proto.WireFixed32, raw: 0x1 },
+			{ tag: 3, wt: proto.WireFixed64, raw: 0x1 },
+			{ tag: 4, wt: proto.WireBytes,
+				packed: []uint64{ 0xff7fffff, 0x3dcccccd },
+				dec: (*proto.Buffer).DecodeFixed32 },
+			{ tag: 5, wt: proto.WireBytes,
+				packed: []uint64{ 0x3fb999999999999a, 0xbf647ae147ae147b },
+				dec: (*proto.Buffer).DecodeFixed64 },
+		} },
+	})
+
+	// beyond the range of float32
+	for _, v := range []string{ "3.5e38", "-3.5e38" } {
+		td := &tableData{
+			Name:      "T",
+			tableMeta: newTm(),
+			RawData:   [][]string{ { "1", v, "0", "0", "0", "0", "0" } },
+		}
+		err = proc.resolveTd(td)
+		if err == nil || ! strings.Contains(err.Error(), ErrFloatOutOfRange.Error()) {
+			t.Errorf("%s: error %v, want %v", v, err, ErrFloatOutOfRange)
+		}
+	}
+}
+
+func TestSerializeZigZag(t *testing.T) {
+	tOpts, err := GetTableOpts("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tm, err := BuildTableMeta("T", "test", "", tOpts,
+		[]string{ "id", "a", "b", "c", "d[0]", "d[1]", "e" },
+		[]string{ "$int", "$int;$min=-10", "$int64;$zigzag", "$int;$min=Neg",
+			"$int;$zigzag", "$int;$zigzag", "$int;$min=0" })
+	if err != nil {
+		t.Fatal(err)
+	}
+	proc := newTestProcessor(t, map[string]int{ "Neg": -1 })
+	proc.setZigZag(tm.Fields)
+	wantTypes := []string{ "int32", "sint32", "sint64", "sint32", "sint32", "int32" }
+	for i, fi := range tm.Fields {
+		if fi.ProtoType() != wantTypes[i] {
+			t.Errorf("%s: type %s, want %s", fi.Name, fi.ProtoType(), wantTypes[i])
+		}
+	}
+
+	setTestProtoKeys(t, tm.Fields)
+	td := &tableData{
+		Name:      "T",
+		tableMeta: tm,
+		RawData:   [][]string{
+			{ "1", "-5", "-3000000000", "-1", "-1", "2", "5" },
+		},
+	}
+	err = proc.resolveTd(td)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := serializeTestTable(t, tm, td)
+	// zigzag maps 0, -1, 1, -2, ... to 0, 1, 2, 3, ...
+	checkTestPb(t, "T", b, []testPbField{
+		{ tag: 1, wt: proto.WireBytes, sub: []testPbField{
+			{ tag: 1, wt: proto.WireVarint, raw: 1 },
+			{ tag: 2, wt: proto.WireVarint, raw: 9 },
+			{ tag: 3, wt: proto.WireVarint, raw: 5999999999 },
+			{ tag: 4, wt: proto.WireVarint, raw: 1 },
+			{ tag: 5, wt: proto.WireBytes,
+				packed: []uint64{ 0xffffffff, 2 },
+				dec: (*proto.Buffer).DecodeZigzag32 },
+			{ tag: 6, wt: proto.WireVarint, raw: 5 },
+		} },
+	})
+}
+
+func TestResolveList(t *testing.T) {
+	proc := newTestProcessor(t, map[string]int{ "Ten": 10 })
+	tests := []struct {
+		optStr string
+		v      string
+		want   []int
+		err    error
+	}{
+		{ "$int;$list", "", []int{}, nil },
+		{ "$int;$list", "1, Ten; -3", []int{ 1, 10, -3 }, nil },
+		{ "$int;$list", "1,x", nil, ErrInvalidInt },
+		{ "$int;$list", "1,,2", nil, ErrInvalidList },
+		{ "$int;$list;$minlen=2", "1,2", []int{ 1, 2 }, nil },
+		{ "$int;$list;$minlen=2", "1", nil, ErrInvalidList },
+		{ "$int;$list;$minlen=1", "", nil, ErrInvalidList },
+		{ "$int;$list;$maxlen=2", "1;2", []int{ 1, 2 }, nil },
+		{ "$int;$list;$maxlen=2", "1;2;3", nil, ErrInvalidList },
+		{ "$int;$list;$min=0", "1,-1", nil, ErrIntOutOfRange },
+		{ "$bool;$list", "true,0", []int{ 1, 0 }, nil },
+	}
+	for _, tt := range tests {
+		fi := &fieldDef{ Name: "l" }
+		err := setFieldTypeAndOpts(fi, tt.optStr, false)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.optStr, err)
+		}
+		if len(fi.MinStr) > 0 {
+			fi.Min, err = proc.resolveInt(fi.MinStr, fi.Type, nil)
+			if err != nil {
+				t.Fatalf("%s: %v", tt.optStr, err)
+			}
+		}
+		got, err := proc.resolveList(fi, tt.v)
+		if tt.err != nil {
+			if err == nil || ! strings.Contains(err.Error(), tt.err.Error()) {
+				t.Errorf("%s: resolveList(%q): error %v, want %v",
+					tt.optStr, tt.v, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || len(got) != len(tt.want) ||
+			(len(got) > 0 && ! reflect.DeepEqual(got, tt.want)) {
+			t.Errorf("%s: resolveList(%q) = %v, %v, want %v",
+				tt.optStr, tt.v, got, err, tt.want)
+		}
+	}
+}
+
+func TestResolveMap(t *testing.T) {
+	proc := newTestProcessor(t, map[string]int{ "Ten": 10 })
+	tests := []struct {
+		optStr string
+		v      string
+		want   []int
+		err    error
+	}{
+		{ "$map=int,int", "", []int{}, nil },
+		{ "$map=int,int", "1:10, Ten:-2; 3:Ten", []int{ 1, 10, 10, -2, 3, 10 }, nil },
+		{ "$map=int,bool", "1:true, 2:0", []int{ 1, 1, 2, 0 }, nil },
+		{ "$map=int,int", "1:x", nil, ErrInvalidInt },
+		{ "$map=int,int", "x:1", nil, ErrInvalidInt },
+		{ "$map=int,int", "1", nil, ErrInvalidMap },
+		// duplicate keys are found by resolved values
+		{ "$map=int,int", "1:1, 1:2", nil, ErrInvalidMap },
+		{ "$map=int,int", "10:1, Ten:2", nil, ErrInvalidMap },
+		{ "$map=int,int", "1:1, +1:2", nil, ErrInvalidMap },
+		{ "$map=string,int", "a:1, A:2", nil, nil },
+		{ "$map=string,int", "a:1, a:2", nil, ErrInvalidMap },
+	}
+	for _, tt := range tests {
+		fi := &fieldDef{ Name: "m" }
+		err := setFieldTypeAndOpts(fi, tt.optStr, false)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.optStr, err)
+		}
+		got, err := proc.resolveMap(fi, tt.v)
+		if tt.err != nil {
+			if err == nil || ! strings.Contains(err.Error(), tt.err.Error()) {
+				t.Errorf("%s: resolveMap(%q): error %v, want %v",
+					tt.optStr, tt.v, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: resolveMap(%q): %v", tt.optStr, tt.v, err)
+		} else if tt.want != nil && fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("%s: resolveMap(%q) = %v, want %v",
+				tt.optStr, tt.v, got, tt.want)
+		}
+	}
+}
+
+func TestCheckString(t *testing.T) {
+	tests := []struct {
+		optStr string
+		v      string
+		err    error
+	}{
+		{ "$string;$pattern=[a-z]+", "abc", nil },
+		{ "$string;$pattern=[a-z]+", "ab1", ErrInvalidString },
+		// pattern must match the whole value
+		{ "$string;$pattern=[a-z]", "ab", ErrInvalidString },
+		{ "$string;$pattern=[a-z]+", "", nil },
+		{ "$string;$minlen=2;$maxlen=3", "ab", nil },
+		{ "$string;$minlen=2;$maxlen=3", "abc", nil },
+		{ "$string;$minlen=2;$maxlen=3", "a", ErrInvalidString },
+		{ "$string;$minlen=2;$maxlen=3", "abcd", ErrInvalidString },
+		// length is in characters
+		{ "$string;$minlen=2;$maxlen=3", "검검검", nil },
+		{ "$string;$minlen=2;$maxlen=3", "검검검검", ErrInvalidString },
+		{ "$string;$minlen=2", "", nil },
+		{ "$string;$nonempty", "a", nil },
+		{ "$string;$nonempty", "", ErrInvalidString },
+		{ "$text;$nonempty;$maxlen=2", "abc", ErrInvalidString },
+	}
+	for _, tt := range tests {
+		fi := &fieldDef{ Name: "s" }
+		err := setFieldTypeAndOpts(fi, tt.optStr, false)
+		if err == nil && len(fi.Pattern) > 0 {
+			fi.rePattern, err = compilePattern(fi.Pattern)
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", tt.optStr, err)
+		}
+		err = checkString(fi, tt.v)
+		if tt.err == nil {
+			if err != nil {
+				t.Errorf("%s: checkString(%q): %v", tt.optStr, tt.v, err)
+			}
+			continue
+		}
+		if err == nil || ! strings.Contains(err.Error(), tt.err.Error()) {
+			t.Errorf("%s: checkString(%q): error %v, want %v",
+				tt.optStr, tt.v, err, tt.err)
+		}
+	}
+}
+
+// resolveTestTable builds table data of lines, and resolves it.
+func resolveTestTable(t *testing.T, proc *processor, tOptStr string,
+	fNames, fOptStrs []string, lines [][]string) (*tableData, error) {
+
+	t.Helper()
+	tOpts, err := GetTableOpts(tOptStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tm, err := BuildTableMeta("T", "test", "", tOpts, fNames, fOptStrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	td := &tableData{ Name: "T", tableMeta: tm, RawData: lines }
+	return td, proc.resolveTd(td)
+}
+
+func TestCheckUnique(t *testing.T) {
+	tests := []struct {
+		name    string
+		tOptStr string
+		fOpts   []string
+		lines   [][]string
+		err     error
+	}{
+		{
+			"unique field", "",
+			[]string{ "$int", "$string;$unique", "$int;$unique" },
+			[][]string{ { "1", "a", "1" }, { "2", "b", "2" }, { "3", "", "" } },
+			nil,
+		},
+		{
+			"duplicate string", "",
+			[]string{ "$int", "$string;$unique", "$int" },
+			[][]string{ { "1", "a", "1" }, { "2", "a", "2" } },
+			ErrDuplicateValue,
+		},
+		{
+			"duplicate by resolved value", "",
+			[]string{ "$int", "$string", "$int;$unique" },
+			[][]string{ { "1", "a", "1" }, { "2", "b", "+1" } },
+			ErrDuplicateValue,
+		},
+		{
+			"empty values are not compared", "",
+			[]string{ "$int", "$string;$unique", "$int" },
+			[][]string{ { "1", "", "1" }, { "2", "", "2" } },
+			nil,
+		},
+		{
+			"unique fields", "$unique=s,n",
+			[]string{ "$int", "$string", "$int" },
+			[][]string{ { "1", "a", "1" }, { "2", "a", "2" }, { "3", "b", "1" } },
+			nil,
+		},
+		{
+			"duplicate in unique fields", "$unique=s,n",
+			[]string{ "$int", "$string", "$int" },
+			[][]string{ { "1", "a", "1" }, { "2", "b", "1" }, { "3", "a", "1" } },
+			ErrDuplicateValue,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := resolveTestTable(t, newTestProcessor(t, nil), tt.tOptStr,
+				[]string{ "id", "s", "n" }, tt.fOpts, tt.lines)
+			if tt.err == nil {
+				if err != nil {
+					t.Error(err)
+				}
+				return
+			}
+			if err == nil || ! strings.Contains(err.Error(), tt.err.Error()) {
+				t.Errorf("error %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestCheckCoverAll(t *testing.T) {
+	tests := []struct {
+		name  string
+		fOpts []string
+		lines [][]string
+		err   error
+	}{
+		{
+			"covered", []string{ "$int", "$keysof=Item;$coverall" },
+			[][]string{ { "1", "Sword" }, { "2", "Bow" }, { "3", "Sword" } },
+			nil,
+		},
+		{
+			"missing", []string{ "$int", "$keysof=Item;$coverall" },
+			[][]string{ { "1", "Sword" }, { "2", "Sword" } },
+			ErrNotCovered,
+		},
+		{
+			"covered by list", []string{ "$int", "$keysof=Item;$coverall;$list" },
+			[][]string{ { "1", "Sword" }, { "2", "Bow, Sword" } },
+			nil,
+		},
+		{
+			"missing in list", []string{ "$int", "$keysof=Item;$coverall;$list" },
+			[][]string{ { "1", "Sword" }, { "2", "" } },
+			ErrNotCovered,
+		},
+		{
+			"covered by map keys", []string{ "$int", "$map=id,int;$keysof=Item;$coverall" },
+			[][]string{ { "1", "Sword: 1, Bow: 2" } },
+			nil,
+		},
+		{
+			"missing in map keys", []string{ "$int", "$map=id,int;$keysof=Item;$coverall" },
+			[][]string{ { "1", "Sword: 1" }, { "2", "Sword: 2" } },
+			ErrNotCovered,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proc := newTestProcessor(t, nil)
+			tm := &tableMeta{ Name: "Item" }
+			for i, name := range []string{ "Sword", "Bow" } {
+				proc.st.AddIds(map[string]int{ name: 100 + i })
+				ak, err := proc.st.AddNewSymbol(name, "test", "Item", stAutoKey, 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				tm.AutoKeys = append(tm.AutoKeys, ak)
+			}
+			proc.tms["Item"] = tm
+			_, err := resolveTestTable(t, proc, "",
+				[]string{ "id", "item" }, tt.fOpts, tt.lines)
+			if tt.err == nil {
+				if err != nil {
+					t.Error(err)
+				}
+				return
+			}
+			if err == nil || ! strings.Contains(err.Error(), tt.err.Error()) {
+				t.Errorf("error %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestCheckKeys(t *testing.T) {
+	tests := []struct {
+		name  string
+		fOpts []string
+		lines [][]string
+		err   error
+	}{
+		{
+			"unique", []string{ "$int", "$string" },
+			[][]string{ { "1", "a" }, { "2", "a" }, { "Ten", "b" } },
+			nil,
+		},
+		{
+			"duplicate", []string{ "$int", "$string" },
+			[][]string{ { "1", "a" }, { "2", "b" }, { "1", "c" } },
+			ErrDuplicateKey,
+		},
+		{
+			"duplicate by resolved value", []string{ "$int", "$string" },
+			[][]string{ { "10", "a" }, { "Ten", "b" } },
+			ErrDuplicateKey,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proc := newTestProcessor(t, map[string]int{ "Ten": 10 })
+			_, err := resolveTestTable(t, proc, "",
+				[]string{ "id", "s" }, tt.fOpts, tt.lines)
+			if tt.err == nil {
+				if err != nil {
+					t.Error(err)
+				}
+				return
+			}
+			if err == nil || ! strings.Contains(err.Error(), tt.err.Error()) {
+				t.Errorf("error %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestSerializeSorted(t *testing.T) {
+	lines := [][]string{ { "10", "c" }, { "1", "a" }, { "2", "b" } }
+	tests := []struct {
+		tOptStr string
+		keys    []uint64
+		values  []string
+	}{
+		{ "", []uint64{ 10, 1, 2 }, []string{ "c", "a", "b" } },
+		{ "$sorted", []uint64{ 1, 2, 10 }, []string{ "a", "b", "c" } },
+	}
+	for _, tt := range tests {
+		td, err := resolveTestTable(t, newTestProcessor(t, nil), tt.tOptStr,
+			[]string{ "id", "s" }, []string{ "$int", "$string" }, lines)
+		if err != nil {
+			t.Fatal(err)
+		}
+		setTestProtoKeys(t, td.Fields)
+		b := serializeTestTable(t, td.tableMeta, td)
+		want := []testPbField{}
+		for i, k := range tt.keys {
+			want = append(want, testPbField{ tag: 1, wt: proto.WireBytes,
+				sub: []testPbField{
+					{ tag: 1, wt: proto.WireVarint, raw: k },
+					{ tag: 2, wt: proto.WireBytes, data: tt.values[i] },
+				} })
+		}
+		checkTestPb(t, "T" + tt.tOptStr, b, want)
+	}
+}
+
+func TestCheckRefs(t *testing.T) {
+	tests := []struct {
+		name  string
+		fOpt  string
+		lines [][]string
+		err   error
+	}{
+		{
+			"keys", "$int;$ref=Monster",
+			[][]string{ { "1", "10" }, { "2", "20" } },
+			nil,
+		},
+		{
+			"not a key", "$int;$ref=Monster",
+			[][]string{ { "1", "10" }, { "2", "30" } },
+			ErrKeyOutOfRange,
+		},
+		{
+			"empty", "$int;$ref=Monster",
+			[][]string{ { "1", "" } },
+			ErrKeyOutOfRange,
+		},
+		{
+			"optional empty", "$int;$ref=Monster;$optional",
+			[][]string{ { "1", "" } },
+			nil,
+		},
+		{
+			"list", "$int;$ref=Monster;$list",
+			[][]string{ { "1", "10, 20" }, { "2", "" } },
+			nil,
+		},
+		{
+			"not a key in list", "$int;$ref=Monster;$list",
+			[][]string{ { "1", "10, 0" } },
+			ErrKeyOutOfRange,
+		},
+		{
+			"map values", "$map=int,int;$ref=Monster",
+			[][]string{ { "1", "30: 10, 40: 20" } },
+			nil,
+		},
+		{
+			"not a key in map values", "$map=int,int;$ref=Monster",
+			[][]string{ { "1", "10: 30" } },
+			ErrKeyOutOfRange,
+		},
+		{
+			"unknown table", "$int;$ref=Boss",
+			[][]string{ { "1", "10" } },
+			ErrUndefinedSymbol,
+		},
+		{
+			"autokey table", "$int;$ref=Item",
+			[][]string{ { "1", "10" } },
+			ErrInvalidFieldDef,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proc := newTestProcessor(t, nil)
+			refTd, err := resolveTestTable(t, proc, "",
+				[]string{ "id" }, []string{ "$int" }, [][]string{ { "10" }, { "20" } })
+			if err != nil {
+				t.Fatal(err)
+			}
+			proc.tds["Monster"] = refTd
+			proc.tds["Item"] = &tableData{
+				tableMeta: &tableMeta{ Fields: []*fieldDef{ { Type: vtId, AutoKey: true } } },
+			}
+			_, err = resolveTestTable(t, proc, "",
+				[]string{ "id", "r" }, []string{ "$int", tt.fOpt }, tt.lines)
+			if tt.err == nil {
+				if err != nil {
+					t.Error(err)
+				}
+				return
+			}
+			if err == nil || ! strings.Contains(err.Error(), tt.err.Error()) {
+				t.Errorf("error %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestResolveTdCompositeKeys(t *testing.T) {
+	fOpts := []string{ "$string", "$int", "$int", "$int;$unique" }
+	tests := []struct {
+		name  string
+		lines [][]string
+		err   error
+	}{
+		{
+			"keys", [][]string{ { "x", "1", "1", "1" }, { "x", "1", "2", "2" },
+				{ "y", "2", "1", "3" } },
+			nil,
+		},
+		{
+			"invalid key", [][]string{ { "x", "1", "1", "1" }, { "y", "a", "1", "2" } },
+			ErrInvalidInt,
+		},
+		{
+			"duplicate keys", [][]string{ { "x", "1", "2", "1" }, { "y", "1", "2", "2" } },
+			ErrDuplicateKey,
+		},
+		{
+			"duplicate value", [][]string{ { "x", "1", "1", "1" }, { "y", "1", "2", "1" } },
+			ErrDuplicateValue,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := resolveTestTable(t, newTestProcessor(t, nil), "$keys=a,b",
+				[]string{ "s", "a", "b", "v" }, fOpts, tt.lines)
+			if tt.err == nil {
+				if err != nil {
+					t.Error(err)
+				}
+				return
+			}
+			if err == nil || ! strings.Contains(err.Error(), tt.err.Error()) {
+				t.Errorf("error %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
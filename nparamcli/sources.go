@@ -0,0 +1,195 @@
+package nparamcli
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bluegol/errutil"
+)
+
+// sourceDef is an entry of sources in config file.
+// Include and Exclude are glob patterns relative to Dir, separated by /.
+// besides the usual glob syntax, ** matches any number of directories.
+//
+//	sources:
+//	  - dir: Tables
+//	    include: [ "**/*.xlsx", "**/*.table" ]
+//	    exclude: [ "**/old/**" ]
+//
+// if no source is given, files in the current directory are used,
+// without searching its subdirectories.
+type sourceDef struct {
+	Dir     string
+	Include []string
+	Exclude []string
+}
+
+func defaultSources() []*sourceDef {
+	return []*sourceDef{ { Dir: ".", Include: []string{ "*" } } }
+}
+
+func (s *sourceDef) normalize() error {
+	if len(s.Dir) == 0 {
+		s.Dir = "."
+	}
+	s.Dir = filepath.Clean(s.Dir)
+	if len(s.Include) == 0 {
+		s.Include = []string{ "**/*" }
+	}
+	for _, patterns := range [][]string{ s.Include, s.Exclude } {
+		for i, p := range patterns {
+			p = filepath.ToSlash(p)
+			for _, part := range strings.Split(p, "/") {
+				_, err := path.Match(part, "")
+				if err != nil {
+					return errutil.New(ErrConfigFile,
+						errutil.MoreInfo, "invalid source pattern",
+						"dir", s.Dir, "pattern", p)
+				}
+			}
+			patterns[i] = p
+		}
+	}
+	return nil
+}
+
+// findSourceFiles returns files in the given sources, sorted.
+// file names are relative to the current directory and separated by /.
+// work, output, text, bin and hidden directories are never searched, nor
+// directories under which no include pattern can match.
+func findSourceFiles(sources []*sourceDef) ([]string, error) {
+	skipDirs := map[string]bool{}
+	for _, d := range []string{ workDir, outputDir, textDir, binDir } {
+		abs, err := filepath.Abs(d)
+		if err != nil {
+			return nil, errutil.AssertEmbed(err, "dir", d)
+		}
+		skipDirs[abs] = true
+	}
+
+	found := map[string]bool{}
+	for _, s := range sources {
+		err := filepath.Walk(s.Dir, func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(s.Dir, p)
+			if err != nil {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+			if info.IsDir() {
+				if p == s.Dir {
+					return nil
+				}
+				abs, err := filepath.Abs(p)
+				if err != nil {
+					return err
+				}
+				if skipDirs[abs] ||
+					strings.HasPrefix(info.Name(), ".") ||
+					matchAnyGlob(s.Exclude, rel) ||
+					! mayMatchUnder(s.Include, rel) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if matchAnyGlob(s.Include, rel) && ! matchAnyGlob(s.Exclude, rel) {
+				found[filepath.ToSlash(p)] = true
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, errutil.AssertEmbed(err,
+				errutil.MoreInfo, "while searching source files",
+				"dir", s.Dir)
+		}
+	}
+
+	fns := make([]string, 0, len(found))
+	for fn, _ := range found {
+		fns = append(fns, fn)
+	}
+	sort.Strings(fns)
+	return fns, nil
+}
+
+// isInputFile reports whether fn is an input file, by its extension.
+// temporary files of excel such as ~$Book1.xlsx are not input files.
+func isInputFile(fn string) bool {
+	_, f, ext := DecomposePath(fn)
+	if strings.HasPrefix(f, "~$") {
+		return false
+	}
+	switch ext {
+	case extXlsx, extOds, extTable, extConst, extCsv, extTsv:
+		return true
+	default:
+		return false
+	}
+}
+
+func matchAnyGlob(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if matchGlob(p, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// mayMatchUnder reports whether any of patterns can match a file under
+// slash-separated directory dir.
+func mayMatchUnder(patterns []string, dir string) bool {
+	ds := strings.Split(dir, "/")
+	outerLoop:
+	for _, p := range patterns {
+		ps := strings.Split(p, "/")
+		for i, d := range ds {
+			if i < len(ps) && ps[i] == "**" {
+				return true
+			}
+			if i >= len(ps) - 1 {
+				// the last part is for the file
+				continue outerLoop
+			}
+			ok, err := path.Match(ps[i], d)
+			if err != nil || ! ok {
+				continue outerLoop
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// matchGlob reports whether slash-separated name matches pattern.
+// ** in pattern matches zero or more path elements.
+func matchGlob(pattern, name string) bool {
+	return matchGlobParts(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchGlobParts(ps, ns []string) bool {
+	for len(ps) > 0 {
+		if ps[0] == "**" {
+			for i := 0; i <= len(ns); i++ {
+				if matchGlobParts(ps[1:], ns[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(ns) == 0 {
+			return false
+		}
+		ok, err := path.Match(ps[0], ns[0])
+		if err != nil || ! ok {
+			return false
+		}
+		ps, ns = ps[1:], ns[1:]
+	}
+	return len(ns) == 0
+}
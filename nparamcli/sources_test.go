@@ -0,0 +1,130 @@
+package nparamcli
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{ "*", "a.xlsx", true },
+		{ "*", "sub/a.xlsx", false },
+		{ "*.xlsx", "a.table", false },
+		{ "sub/*.xlsx", "sub/a.xlsx", true },
+		{ "sub/*.xlsx", "sub/x/a.xlsx", false },
+		{ "**/*.xlsx", "a.xlsx", true },
+		{ "**/*.xlsx", "a/b/c.xlsx", true },
+		{ "**/*.xlsx", "a/b/c.table", false },
+		{ "a/**/c.xlsx", "a/c.xlsx", true },
+		{ "a/**/c.xlsx", "a/x/y/c.xlsx", true },
+		{ "a/**/c.xlsx", "b/x/c.xlsx", false },
+		{ "**", "a/b/c", true },
+		{ "**/old/**", "old/a.xlsx", true },
+		{ "**/old/**", "x/old/y/a.xlsx", true },
+		{ "**/old/**", "x/older/a.xlsx", false },
+		{ "[", "[", false },
+	}
+	for _, tt := range tests {
+		got := matchGlob(tt.pattern, tt.name)
+		if got != tt.want {
+			t.Errorf("matchGlob(%q, %q) = %v, want %v",
+				tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMayMatchUnder(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		dir      string
+		want     bool
+	}{
+		{ []string{ "*" }, "sub", false },
+		{ []string{ "sub/*.xlsx" }, "sub", true },
+		{ []string{ "sub/*.xlsx" }, "other", false },
+		{ []string{ "sub/*.xlsx" }, "sub/x", false },
+		{ []string{ "**/*.xlsx" }, "a/b", true },
+		{ []string{ "**" }, "a", true },
+		{ []string{ "a/**/*.xlsx" }, "a/b/c", true },
+		{ []string{ "a/**/*.xlsx" }, "b", false },
+		{ []string{ "*", "s*/*" }, "sub", true },
+	}
+	for _, tt := range tests {
+		got := mayMatchUnder(tt.patterns, tt.dir)
+		if got != tt.want {
+			t.Errorf("mayMatchUnder(%q, %q) = %v, want %v",
+				tt.patterns, tt.dir, got, tt.want)
+		}
+	}
+}
+
+func TestFindSourceFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, fn := range []string{
+		"a.xlsx", "b.table", "sub/c.xlsx", "sub/old/d.xlsx", "sub/x/e.table",
+		workDir + "w.xlsx", outputDir + "o.table", textDir + "t.table",
+		".git/h.xlsx",
+	} {
+		p := filepath.Join(dir, filepath.FromSlash(fn))
+		err := os.MkdirAll(filepath.Dir(p), os.ModePerm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(p, nil, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chdir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	tests := []struct {
+		name    string
+		sources []*sourceDef
+		want    []string
+	}{
+		{
+			name:    "default",
+			sources: defaultSources(),
+			want:    []string{ "a.xlsx", "b.table" },
+		},
+		{
+			name:    "recursive with exclude",
+			sources: []*sourceDef{ {
+				Dir: ".",
+				Include: []string{ "**/*.xlsx", "**/*.table" },
+				Exclude: []string{ "**/old/**" },
+			} },
+			want:    []string{ "a.xlsx", "b.table", "sub/c.xlsx", "sub/x/e.table" },
+		},
+		{
+			name:    "sub dir",
+			sources: []*sourceDef{ { Dir: "sub", Include: []string{ "*" } } },
+			want:    []string{ "sub/c.xlsx" },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := findSourceFiles(tt.sources)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ! reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -217,7 +217,7 @@ func (st *symbolTable) ResolveFixed4(ids string) (bool, int) {
 func init() {
 	reUserDefinedSymbol, _ = regexp.Compile(`^[A-Za-z][0-9_A-Za-z]*$`)
 	reInternalSymbol, _ =
-		regexp.Compile(`^[_A-Za-z][0-9_A-Za-z]*(\.[_A-Za-z][0-9_A-Za-z]*){0,3}$`)
+		regexp.Compile(`^[_A-Za-z][0-9_A-Za-z]*(\.[_A-Za-z][0-9_A-Za-z]*)*$`)
 
 	ErrInvalidSymbol = errors.New("잘못된 심볼")
 	ErrUndefinedSymbol = errors.New("정의되지 않은 심볼")
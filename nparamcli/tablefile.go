@@ -0,0 +1,245 @@
+package nparamcli
+
+// .table file is a plain text version of xlsx sheet, so that small tables
+// can be kept in version control without excel.
+// each line is a row, and cells are separated by tab. spaces around cells
+// are ignored. empty lines and lines starting with # are ignored.
+//
+//	$const	SomeConst	100
+//
+//	$table	TableName	$partial
+//	id	hp	name
+//	$autokey	$int; $min=0	$string
+//	Key1	100	first
+//	Key2	200	second
+//	$end
+//
+// unlike xlsx, field name row doesn't need $end, and every table,
+// including single-row table, must end with $end.
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/bluegol/errutil"
+)
+
+var (
+	ErrTblFileInvalidTableDef error
+	ErrTblFileInvalidConstDef error
+)
+
+type tblFileLine struct {
+	num   int
+	cells []string
+	cols  []int
+}
+
+func ParseTableFile(fn string) ([]*cdef, []*tableMeta, [][][]string, error) {
+	lines, err := readTblFileLines(fn)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	cdefs := []*cdef{}
+	tms := []*tableMeta{}
+	tds := [][][]string{}
+	tables := map[string]*tableMeta{}
+	loc := func(l *tblFileLine, k int) string {
+		if k < len(l.cols) {
+			return tblFileLoc(fn, l.num, l.cols[k])
+		}
+		return tblFileLoc(fn, l.num, 1)
+	}
+
+	for j := 0; j < len(lines); j++ {
+		line := lines[j]
+		switch line.cells[0] {
+
+		case kwConst:
+			if len(line.cells) != 3 {
+				return nil, nil, nil, errutil.New(ErrTblFileInvalidConstDef,
+					"loc", loc(line, 0))
+			}
+			v := line.cells[2]
+			iv, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, nil, nil, errutil.New(ErrTblFileInvalidConstDef,
+					errutil.MoreInfo, "not int",
+					"value", v, "loc", loc(line, 2))
+			}
+			cdefs = append(cdefs,
+				&cdef{
+					Name: line.cells[1],
+					Value: iv,
+					XlsxLoc: loc(line, 1) } )
+
+		case kwTable:
+			tLoc := loc(line, 0)
+			if len(line.cells) < 2 || len(line.cells[1]) == 0 {
+				return nil, nil, nil, errutil.New(ErrTblFileInvalidTableDef,
+					errutil.MoreInfo, "no table name",
+					"loc", tLoc)
+			}
+			if len(line.cells) > 3 {
+				return nil, nil, nil, errutil.New(ErrTblFileInvalidTableDef,
+					errutil.MoreInfo, "too many cells in table header",
+					"loc", tLoc)
+			}
+			tName := line.cells[1]
+			var tblOptStr string
+			if len(line.cells) > 2 {
+				tblOptStr = line.cells[2]
+			}
+			tOpts, err := GetTableOpts(tblOptStr)
+			if err != nil {
+				return nil, nil, nil, errutil.Embed(ErrTblFileInvalidTableDef, err,
+					errutil.MoreInfo, "invalid table options",
+					"table", tName, "loc", tLoc)
+			}
+
+			// field names and field options
+			if j+2 >= len(lines) {
+				return nil, nil, nil, errutil.New(ErrTblFileInvalidTableDef,
+					errutil.MoreInfo, "no field def",
+					"table", tName, "loc", tLoc)
+			}
+			fieldLine := lines[j+1]
+			fieldOptLine := lines[j+2]
+			if len(fieldOptLine.cells) != len(fieldLine.cells) {
+				return nil, nil, nil, errutil.New(ErrTblFileInvalidTableDef,
+					errutil.MoreInfo, "field opt count mismatch",
+					"num_fields", strconv.Itoa(len(fieldLine.cells)),
+					"num_field_opts", strconv.Itoa(len(fieldOptLine.cells)),
+					"table", tName, "loc", loc(fieldOptLine, 0))
+			}
+			numFields := len(fieldLine.cells)
+			tm, err := BuildTableMeta(tName, fn, tLoc, tOpts,
+				fieldLine.cells, fieldOptLine.cells)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+
+			// data rows
+			endRow := -1
+			for jj := j+3; jj < len(lines); jj++ {
+				c := lines[jj].cells[0]
+				if c == kwEnd {
+					endRow = jj
+					break
+				} else if c == kwTable || c == kwConst {
+					break
+				}
+			}
+			if endRow < 0 {
+				return nil, nil, nil, errutil.New(ErrTblFileInvalidTableDef,
+					errutil.MoreInfo, "no row end",
+					"table", tName, "loc", tLoc)
+			}
+			numRows := endRow - (j + 3)
+			if tm.SingleRow && numRows != 1 {
+				return nil, nil, nil, errutil.New(ErrTblFileInvalidTableDef,
+					errutil.MoreInfo, "single-row table must have exactly one row",
+					"rows", strconv.Itoa(numRows),
+					"table", tName, "loc", tLoc)
+			}
+			data := make([][]string, numRows)
+			tm.RowLocs = make([]string, numRows)
+			for jj := 0; jj < numRows; jj++ {
+				line := lines[jj+j+3]
+				tm.RowLocs[jj] = loc(line, 0)
+				if len(line.cells) > numFields {
+					return nil, nil, nil, errutil.New(ErrTblFileInvalidTableDef,
+						errutil.MoreInfo, "too many cells in row",
+						"table", tName, "loc", loc(line, numFields))
+				}
+				data[jj] = make([]string, numFields)
+				copy(data[jj], line.cells)
+			}
+			tm.setAutoKeyNames(data)
+
+			prev, exists := tables[tm.Name]
+			if exists {
+				return nil, nil, nil, errutil.New(ErrDuplicateTblNames,
+					"table", tm.Name,
+					"loc", tm.XlsxLoc, "prev_loc", prev.XlsxLoc)
+			}
+			tables[tm.Name] = tm
+			tms = append(tms, tm)
+			tds = append(tds, data)
+			j = endRow
+
+		default:
+			return nil, nil, nil, errutil.New(ErrTblFileInvalidTableDef,
+				errutil.MoreInfo, "line outside of table",
+				"loc", loc(line, 0))
+
+		}
+	}
+
+	return cdefs, tms, tds, nil
+}
+
+// readTblFileLines reads fn and splits each line into cells,
+// skipping empty and comment lines. trailing empty cells are dropped,
+// as in xlsx. columns are counted in characters, not bytes.
+func readTblFileLines(fn string) ([]*tblFileLine, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, errutil.Embed(ErrCannotOpen, err, "file", fn)
+	}
+	defer f.Close()
+
+	lines := []*tblFileLine{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	num := 0
+	for scanner.Scan() {
+		num++
+		s := strings.TrimRight(scanner.Text(), "\r")
+		if num == 1 {
+			// utf-8 bom
+			s = strings.TrimPrefix(s, "\ufeff")
+		}
+		trimmed := strings.TrimSpace(s)
+		if len(trimmed) == 0 || trimmed[0] == '#' {
+			continue
+		}
+
+		line := &tblFileLine{ num: num }
+		col := 0
+		for _, c := range strings.Split(s, "\t") {
+			lead := utf8.RuneCountInString(c) -
+				utf8.RuneCountInString(strings.TrimLeft(c, " "))
+			line.cells = append(line.cells, strings.TrimSpace(c))
+			line.cols = append(line.cols, col+lead+1)
+			col += utf8.RuneCountInString(c) + 1
+		}
+		n := len(line.cells)
+		for n > 1 && len(line.cells[n-1]) == 0 {
+			n--
+		}
+		line.cells = line.cells[:n]
+		line.cols = line.cols[:n]
+		lines = append(lines, line)
+	}
+	err = scanner.Err()
+	if err != nil {
+		return nil, errutil.Embed(ErrCannotOpen, err, "file", fn)
+	}
+	return lines, nil
+}
+
+func tblFileLoc(fn string, line, col int) string {
+	return fmt.Sprintf("%s:%d:%d", fn, line, col)
+}
+
+func init() {
+	ErrTblFileInvalidTableDef = errors.New(".table 파일에서 table 정의가 잘못됨")
+	ErrTblFileInvalidConstDef = errors.New(".table 파일에서 const 정의가 잘못됨")
+}
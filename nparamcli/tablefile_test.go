@@ -0,0 +1,171 @@
+package nparamcli
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeTestFile(t *testing.T, name, content string) string {
+	t.Helper()
+	fn := filepath.Join(t.TempDir(), name)
+	err := os.WriteFile(fn, []byte(content), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fn
+}
+
+func TestReadTblFileLines(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		nums    []int
+		cells   [][]string
+		cols    [][]int
+	}{
+		{
+			name:    "comments and empty lines",
+			content: "# comment\n\n  \n$const\tA\t1\n",
+			nums:    []int{ 4 },
+			cells:   [][]string{ {"$const", "A", "1"} },
+			cols:    [][]int{ {1, 8, 10} },
+		},
+		{
+			name:    "spaces around cells",
+			content: "a\t  b \tc\r\n",
+			nums:    []int{ 1 },
+			cells:   [][]string{ {"a", "b", "c"} },
+			cols:    [][]int{ {1, 5, 8} },
+		},
+		{
+			name:    "bom",
+			content: "\ufeffa\tb\n",
+			nums:    []int{ 1 },
+			cells:   [][]string{ {"a", "b"} },
+			cols:    [][]int{ {1, 3} },
+		},
+		{
+			name:    "columns in characters",
+			content: "이름\t값\t x\n",
+			nums:    []int{ 1 },
+			cells:   [][]string{ {"이름", "값", "x"} },
+			cols:    [][]int{ {1, 4, 7} },
+		},
+		{
+			name:    "trailing empty cells",
+			content: "a\t\tb\t\t \t\n",
+			nums:    []int{ 1 },
+			cells:   [][]string{ {"a", "", "b"} },
+			cols:    [][]int{ {1, 3, 4} },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fn := writeTestFile(t, "a.table", tt.content)
+			lines, err := readTblFileLines(fn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(lines) != len(tt.cells) {
+				t.Fatalf("got %d lines, want %d", len(lines), len(tt.cells))
+			}
+			for i, l := range lines {
+				if l.num != tt.nums[i] {
+					t.Errorf("line %d: num %d, want %d", i, l.num, tt.nums[i])
+				}
+				if ! reflect.DeepEqual(l.cells, tt.cells[i]) {
+					t.Errorf("line %d: cells %q, want %q", i, l.cells, tt.cells[i])
+				}
+				if ! reflect.DeepEqual(l.cols, tt.cols[i]) {
+					t.Errorf("line %d: cols %v, want %v", i, l.cols, tt.cols[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseTableFile(t *testing.T) {
+	content := strings.Join([]string{
+		"$const\tMaxLevel\t100",
+		"",
+		"$table\tItem",
+		"id\thp\tname",
+		"$autokey\t$int\t$string",
+		"# comment inside table",
+		"Sword\t10\t검",
+		"  Bow\t7\t",
+		"$end",
+		"",
+		"$table\tConfig\t$singlerow",
+		"maxHp",
+		"$int",
+		"500",
+		"$end",
+	}, "\n")
+	fn := writeTestFile(t, "a.table", content)
+	cdefs, tms, tds, err := ParseTableFile(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cdefs) != 1 || cdefs[0].Name != "MaxLevel" || cdefs[0].Value != 100 {
+		t.Errorf("consts: %+v", cdefs)
+	}
+	if cdefs[0].XlsxLoc != fn + ":1:8" {
+		t.Errorf("const loc %q", cdefs[0].XlsxLoc)
+	}
+	if len(tms) != 2 || tms[0].Name != "Item" || tms[1].Name != "Config" {
+		t.Fatalf("tables: %v", tms)
+	}
+	wantData := [][]string{ {"Sword", "10", "검"}, {"Bow", "7", ""} }
+	if ! reflect.DeepEqual(tds[0], wantData) {
+		t.Errorf("data %q, want %q", tds[0], wantData)
+	}
+	if tms[0].XlsxLoc != fn + ":3:1" || tms[1].XlsxLoc != fn + ":11:1" {
+		t.Errorf("table locs %q %q", tms[0].XlsxLoc, tms[1].XlsxLoc)
+	}
+	wantLocs := []string{ fn + ":7:1", fn + ":8:3" }
+	if ! reflect.DeepEqual(tms[0].RowLocs, wantLocs) {
+		t.Errorf("row locs %q, want %q", tms[0].RowLocs, wantLocs)
+	}
+	if ! reflect.DeepEqual(tms[0].AutoKeyNames, []string{"Sword", "Bow"}) {
+		t.Errorf("autokeys %q", tms[0].AutoKeyNames)
+	}
+	if ! tms[1].SingleRow || ! reflect.DeepEqual(tds[1], [][]string{ {"500"} }) {
+		t.Errorf("single row table: %v %q", tms[1].SingleRow, tds[1])
+	}
+}
+
+func TestParseTableFileErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    error
+	}{
+		{ "const not int", "$const\tA\tx\n", ErrTblFileInvalidConstDef },
+		{ "const without value", "$const\tA\n", ErrTblFileInvalidConstDef },
+		{ "no table name", "$table\n", ErrTblFileInvalidTableDef },
+		{ "too many header cells", "$table\tT\t$partial\tx\n", ErrTblFileInvalidTableDef },
+		{ "no field def", "$table\tT\nid\n", ErrTblFileInvalidTableDef },
+		{ "field opt count", "$table\tT\nid\tv\n$int\n$end\n", ErrTblFileInvalidTableDef },
+		{ "no end", "$table\tT\nid\n$int\n1\n", ErrTblFileInvalidTableDef },
+		{ "too many cells", "$table\tT\nid\n$int\n1\t2\n$end\n", ErrTblFileInvalidTableDef },
+		{ "single row count", "$table\tT\t$singlerow\nid\n$int\n1\n2\n$end\n", ErrTblFileInvalidTableDef },
+		{ "outside of table", "x\ty\n", ErrTblFileInvalidTableDef },
+		{ "duplicate table", "$table\tT\nid\n$int\n$end\n$table\tT\nid\n$int\n$end\n", ErrDuplicateTblNames },
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fn := writeTestFile(t, "a.table", tt.content)
+			_, _, _, err := ParseTableFile(fn)
+			if err == nil {
+				t.Fatal("no error")
+			}
+			if ! strings.Contains(err.Error(), tt.want.Error()) {
+				t.Errorf("error %q, want %q", err, tt.want)
+			}
+		})
+	}
+}
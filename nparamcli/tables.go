@@ -2,7 +2,9 @@ package nparamcli
 
 import (
 	"regexp"
+	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/bluegol/errutil"
 	"fmt"
@@ -19,15 +21,28 @@ var (
 	ErrInvalidInt error
 	ErrInvalidSRTableReference error
 	ErrIntOutOfRange error
+	ErrInvalidBool error
+	ErrInvalidFloat error
+	ErrFloatOutOfRange error
+	ErrInvalidEnum error
+	ErrInvalidList error
+	ErrInvalidMap error
+	ErrInvalidString error
 	ErrNotAutoKey error
 	ErrKeyOutOfRange error
 
 	ErrCyclicDependency error
+	ErrDuplicateValue error
+	ErrNotCovered error
+	ErrDuplicateKey error
 )
 
 const (
 	kwTblOptPartial = "$partial"
 	kwTblOptSingleRow = "$singlerow"
+	kwTblOptSorted = "$sorted"
+	kwTblOptUnique = "$unique"
+	kwTblOptKeys = "$keys"
 )
 
 type tableMeta struct {
@@ -48,9 +63,20 @@ type tableMeta struct {
 	Opts               *Options
 	Fields             []*fieldDef
 	AutoKeyNames       []string
+	// RowLocs are locations of the first cell of each row.
+	// for merged table, file name is prepended.
+	RowLocs            []string
 
 	Partial            bool
 	SingleRow          bool
+	// rows are serialized in ascending order of keys
+	Sorted             bool
+	// names of fields such as reward[0].id, of which values
+	// must be unique together
+	UniqueFields       []string
+	// names of key fields if the key is composite, i.e. rows are
+	// identified by values of the fields together, not by the first field
+	KeyFields          []string
 
 	// two lookups are set after read
 
@@ -95,6 +121,12 @@ func BuildTableMeta(name, src, xlsxLoc string, tOpts *Options,
 	}
 
 	err = setFields(t, fNames, fOptStrs)
+	if err == nil {
+		err = checkUniqueFields(t)
+	}
+	if err == nil {
+		err = checkKeyFields(t)
+	}
 	if err != nil {
 		err = errutil.AddInfo(err, "table", name, "file", src)
 		if len(t.XlsxLoc) > 0 {
@@ -118,6 +150,15 @@ func setTableOpts(t *tableMeta, opts *Options) error {
 			t.Partial = true
 		} else if k == kwTblOptSingleRow {
 			t.SingleRow = true
+		} else if k == kwTblOptSorted {
+			t.Sorted = true
+		}
+	}
+	for k, v := range t.Opts.MultiValued {
+		if k == kwTblOptUnique {
+			t.UniqueFields = v
+		} else if k == kwTblOptKeys {
+			t.KeyFields = v
 		}
 	}
 	if t.Partial && t.SingleRow {
@@ -126,12 +167,105 @@ func setTableOpts(t *tableMeta, opts *Options) error {
 			fmt.Sprintf("cannot set %v and %v at the same time",
 				kwTblOptPartial, kwTblOptSingleRow))
 	}
+	if t.Sorted && t.SingleRow {
+		return errutil.New(ErrTableOpts,
+			errutil.MoreInfo,
+			fmt.Sprintf("cannot set %v and %v at the same time",
+				kwTblOptSorted, kwTblOptSingleRow))
+	}
+	if len(t.KeyFields) > 0 && t.SingleRow {
+		return errutil.New(ErrTableOpts,
+			errutil.MoreInfo,
+			fmt.Sprintf("cannot set %v and %v at the same time",
+				kwTblOptKeys, kwTblOptSingleRow))
+	}
+	return nil
+}
+
+// checkUniqueFields checks if the fields of table option $unique
+// are distinct single-valued fields.
+func checkUniqueFields(t *tableMeta) error {
+	seen := map[string]bool{}
+	for _, name := range t.UniqueFields {
+		o, exists := t.fieldsNameAndOrder[name]
+		if ! exists {
+			return errutil.New(ErrTableOpts,
+				errutil.MoreInfo, "unknown field of " + kwTblOptUnique,
+				"field", name)
+		}
+		fi := t.fieldsByOrder[o]
+		if fi.List || fi.Type == vtMap {
+			return errutil.New(ErrTableOpts,
+				errutil.MoreInfo, "list or map field cannot be in " + kwTblOptUnique,
+				"field", name)
+		}
+		if seen[name] {
+			return errutil.New(ErrTableOpts,
+				errutil.MoreInfo, "duplicate field in " + kwTblOptUnique,
+				"field", name)
+		}
+		seen[name] = true
+	}
+	return nil
+}
+
+// checkKeyFields checks the fields of table option $keys, which must be
+// two or more distinct top-level fields of type int, id or enum.
+func checkKeyFields(t *tableMeta) error {
+	if len(t.KeyFields) == 0 {
+		return nil
+	}
+	if len(t.KeyFields) < 2 {
+		return errutil.New(ErrTableOpts,
+			errutil.MoreInfo, kwTblOptKeys + " needs two or more fields",
+			"fields", strings.Join(t.KeyFields, ","))
+	}
+	seen := map[string]bool{}
+	for _, name := range t.KeyFields {
+		var fi *fieldDef
+		for _, f := range t.Fields {
+			if f.Name == name {
+				fi = f
+			}
+		}
+		if fi == nil || fi.ArrayLen > 0 || len(fi.Subs) > 0 {
+			return errutil.New(ErrTableOpts,
+				errutil.MoreInfo, "unknown top-level field of " + kwTblOptKeys,
+				"field", name)
+		}
+		if (fi.Type != vtInt && fi.Type != vtId && fi.Type != vtEnum) ||
+			fi.List || fi.Optional {
+			return errutil.New(ErrTableOpts,
+				errutil.MoreInfo, "field of " + kwTblOptKeys +
+					" must be single-valued int, id or enum",
+				"field", name, "type", fi.TypeString())
+		}
+		if seen[name] {
+			return errutil.New(ErrTableOpts,
+				errutil.MoreInfo, "duplicate field in " + kwTblOptKeys,
+				"field", name)
+		}
+		seen[name] = true
+	}
 	return nil
 }
 
+// keyColumns returns the columns of key fields, i.e. of $keys or
+// the first column.
+func (t *tableMeta) keyColumns() []int {
+	if len(t.KeyFields) == 0 {
+		return []int{ 0 }
+	}
+	cols := make([]int, len(t.KeyFields))
+	for k, name := range t.KeyFields {
+		cols[k] = t.fieldsNameAndOrder[name]
+	}
+	return cols
+}
+
 func setFields(t *tableMeta, fNames, fOptStrs []string) error {
 	var err error
-	t.Fields, err = BuildFields(fNames, fOptStrs)
+	t.Fields, err = BuildFields(fNames, fOptStrs, len(t.KeyFields) > 0)
 	if err != nil {
 		err = errutil.AddInfo(err, "table", t.Name, "file", t.Src)
 		if len(t.XlsxLoc) > 0 {
@@ -146,92 +280,117 @@ func setFields(t *tableMeta, fNames, fOptStrs []string) error {
 func setFieldsNameAndOrder(t *tableMeta) {
 	t.fieldsNameAndOrder = map[string]int{}
 	t.fieldsByOrder = []*fieldDef{}
+	for _, fi := range t.Fields {
+		t.addFieldNameAndOrder("", fi)
+	}
+}
 
-	o, fNum, fSub, fSubLen, fIndex := -1, -1, -1, -1, -1
-	var mainField, fi *fieldDef
-	nextMainField := func() bool {
-		fNum++
-		if fNum >= len(t.Fields) {
-			return false
-		}
-
-		mainField = t.Fields[fNum]
-		if mainField.ArrayLen > 0 {
-			fIndex = 0
-		} else {
-			fIndex = -1
-		}
-		fSubLen = len(mainField.Subs)
-		if fSubLen > 0 {
-			fSub = 0
-			fi = mainField.Subs[fSub]
-			return true
-		} else {
-			fSub = -1
-			fi = mainField
-			return true
-		}
+// addFieldNameAndOrder adds names such as reward[0].items[1].count
+// of the columns of fi, in the order of columns.
+func (t *tableMeta) addFieldNameAndOrder(prefix string, fi *fieldDef) {
+	count := 1
+	if fi.ArrayLen > 0 {
+		count = fi.ArrayLen
 	}
-	incIndex := func() bool {
-		if mainField == nil || mainField.ArrayLen <= 0 {
-			return nextMainField()
+	for k := 0; k < count; k++ {
+		name := prefix + fi.Name
+		if fi.ArrayLen > 0 {
+			name = fmt.Sprintf("%v[%v]", name, k)
 		}
-
-		fIndex++
-		if fIndex >= mainField.ArrayLen {
-			return nextMainField()
-		} else {
-			if fSubLen > 0 {
-				fSub = 0
-				fi = mainField.Subs[fSub]
+		if len(fi.Subs) > 0 {
+			for _, sub := range fi.Subs {
+				t.addFieldNameAndOrder(name + ".", sub)
 			}
-			return true
+		} else {
+			t.fieldsNameAndOrder[name] = len(t.fieldsByOrder)
+			t.fieldsByOrder = append(t.fieldsByOrder, fi)
 		}
 	}
-	nextField := func() bool {
-		if fSubLen <= 0 {
-			return incIndex()
-		}
+}
 
-		fSub++
-		if fSub >= fSubLen {
-			if fIndex >= 0 {
-				return incIndex()
-			} else {
-				return nextMainField()
+// forEachField calls fn for every field including subs, parents first,
+// with names of the field and its parents.
+func (t *tableMeta) forEachField(fn func(path []string, fi *fieldDef) error) error {
+	var walk func(path []string, fields []*fieldDef) error
+	walk = func(path []string, fields []*fieldDef) error {
+		for _, fi := range fields {
+			p := append(path[:len(path):len(path)], fi.Name)
+			err := fn(p, fi)
+			if err != nil {
+				return err
+			}
+			err = walk(p, fi.Subs)
+			if err != nil {
+				return err
 			}
-		} else {
-			fi = mainField.Subs[fSub]
-			return true
 		}
+		return nil
 	}
-	for {
-		o++
-		if ! nextField() {
-			break
-		}
+	return walk(nil, t.Fields)
+}
 
-		var name string
-		if mainField.ArrayLen > 0 && fSubLen > 0 {
-			name = fmt.Sprintf("%v[%v].%v",
-				t.Fields[fNum].Name, fIndex, fi.Name)
-		} else if mainField.ArrayLen > 0 {
-			name = fmt.Sprintf("%v[%v]", fi.Name, fIndex)
-		} else if fSubLen > 0 {
-			name = fmt.Sprintf("%v.%v", t.Fields[fNum].Name, fi.Name)
-		} else {
-			name = fi.Name
+// ProtoImports returns the proto files to be imported for the
+// well-known types used by the fields.
+func (t *tableMeta) ProtoImports() []string {
+	duration, timestamp := false, false
+	t.forEachField(func(path []string, fi *fieldDef) error {
+		if fi.MapValue != nil {
+			fi = fi.MapValue
 		}
-
-		t.fieldsNameAndOrder[name] = o
-		t.fieldsByOrder = append(t.fieldsByOrder, fi)
+		switch fi.Type {
+		case vtDuration:
+			duration = true
+		case vtDatetime:
+			timestamp = true
+		}
+		return nil
+	})
+	result := []string{}
+	if duration {
+		result = append(result, "google/protobuf/duration.proto")
+	}
+	if timestamp {
+		result = append(result, "google/protobuf/timestamp.proto")
 	}
+	return result
 }
 
 func (t *tableMeta) AutoKey() bool {
 	return t.Fields[0].AutoKey
 }
 
+// setAutoKeyNames sets AutoKeyNames from the key column of data,
+// if the key field is autokey.
+func (t *tableMeta) setAutoKeyNames(data [][]string) {
+	if ! t.AutoKey() {
+		return
+	}
+	t.AutoKeyNames = make([]string, len(data))
+	for j, line := range data {
+		t.AutoKeyNames[j] = line[0]
+	}
+}
+
+// RowLoc returns the location of the i-th row, with file name.
+func (t *tableMeta) RowLoc(i int) string {
+	if i >= len(t.RowLocs) {
+		return ""
+	}
+	if t.Partial {
+		// merged
+		return t.RowLocs[i]
+	}
+	return fileLoc(t.Src, t.RowLocs[i])
+}
+
+// fileLoc prepends file name fn to loc, unless loc already has it.
+func fileLoc(fn, loc string) string {
+	if strings.HasPrefix(loc, fn) {
+		return loc
+	}
+	return fn + " " + loc
+}
+
 func OkToMerge(t, t1 *tableMeta) bool {
 	if t.Name != t1.Name {
 		return false
@@ -255,12 +414,10 @@ func OkToMerge(t, t1 *tableMeta) bool {
 
 func (t *tableMeta) AddNames(names []string) []string {
 	names = append(names, t.Name, FieldTypeSymbolName(t.Name))
-	for _, fi := range t.Fields {
-		names = append(names, FieldSymbolName(t.Name, fi.Name, ""))
-		for _, sfi := range fi.Subs {
-			names = append(names, FieldSymbolName(t.Name, fi.Name, sfi.Name))
-		}
-	}
+	t.forEachField(func(path []string, fi *fieldDef) error {
+		names = append(names, FieldSymbolName(t.Name, path...))
+		return nil
+	})
 	for _, ak := range t.AutoKeyNames {
 		names = append(names, ak)
 	}
@@ -291,31 +448,149 @@ type tableData struct {
 	ReferencedTds  map[string]bool
 
 	Data           [][]int
+	// values of list and map fields, by row and field order.
+	// map is kept as key, value, key, value, ...
+	// nil if the table has no list or map field.
+	ListData       [][][]int
+}
+
+// cellValue returns the value of the j-th column of the i-th row to be
+// compared, i.e. string itself or resolved value.
+func (td *tableData) cellValue(i, j int) string {
+	fi := td.fieldsByOrder[j]
+	if fi.isString() {
+		return fi.rawValue(td.RawData[i][j])
+	}
+	return strconv.Itoa(td.Data[i][j])
+}
+
+// rowOrder returns the indices of rows in the order to be serialized,
+// i.e. ascending order of keys if $sorted, or as read.
+func (td *tableData) rowOrder() []int {
+	order := make([]int, len(td.Data))
+	for i := range order {
+		order[i] = i
+	}
+	if td.Sorted {
+		cols := td.keyColumns()
+		sort.SliceStable(order, func(a, b int) bool {
+			for _, j := range cols {
+				va, vb := td.Data[order[a]][j], td.Data[order[b]][j]
+				if va != vb {
+					return intLess(td.fieldsByOrder[j].Type, va, vb)
+				}
+			}
+			return false
+		})
+	}
+	return order
+}
+
+// rowKey returns the key of the i-th row, i.e. name of id key or
+// resolved value of int key. for composite key, resolved values are
+// joined with , which cannot be in names.
+func (td *tableData) rowKey(i int) string {
+	if len(td.KeyFields) == 0 {
+		if td.Fields[0].Type == vtId {
+			return td.RawData[i][0]
+		}
+		return strconv.Itoa(td.Data[i][0])
+	}
+	cols := td.keyColumns()
+	keys := make([]string, len(cols))
+	for k, j := range cols {
+		keys[k] = formatInt(td.fieldsByOrder[j].Type, td.Data[i][j])
+	}
+	return strings.Join(keys, ",")
 }
 
 const Fixed4Mult = 10000
 
-func DecomposeValue(v string) (bool, int, bool, int, string) {
+// DecomposeValue splits v into sign, integer part, decimal part and unit.
+// integer and decimal parts are left as strings, so that the caller can
+// check the range according to the field type.
+func DecomposeValue(v string) (bool, bool, string, string, string) {
 	m := reValueWithUnit.FindStringSubmatch(v)
 	if m == nil {
-		return false, 0, false, 0, ""
-	}
-	i, _ := strconv.Atoi(m[1])
-	var dexists bool
-	var d int
-	if len(m[3]) == 0 {
-		dexists = false
-	} else {
-		var err error
-		d, err = strconv.Atoi(m[3])
-		if err != nil {
-			dexists = false
-		} else {
-			dexists = true
+		return false, false, "", "", ""
+	}
+	return true, m[1] == "-", m[2], m[4], m[5]
+}
+
+// DecomposeFloatValue splits v into float number and unit.
+// exponent such as 1.5e-3 is allowed.
+func DecomposeFloatValue(v string) (bool, float64, string) {
+	m := reFloatWithUnit.FindStringSubmatch(v)
+	if m == nil {
+		return false, 0, ""
+	}
+	f, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		// out of range
+		return false, 0, ""
+	}
+	return true, f, m[4]
+}
+
+// splitList splits list value into elements separated by , or ;.
+// separators in parentheses such as min(A, B) don't split.
+// spaces around elements and a trailing separator are ignored.
+// empty value is an empty list.
+func splitList(v string) ([]string, error) {
+	v = strings.TrimSpace(v)
+	if len(v) == 0 {
+		return nil, nil
+	}
+	elems := []string{}
+	depth, start := 0, 0
+	for i := 0; i < len(v); i++ {
+		switch v[i] {
+		case '(':
+			depth++
+		case ')':
+			if depth > 0 {
+				depth--
+			}
+		case ',', ';':
+			if depth == 0 {
+				elems = append(elems, strings.TrimSpace(v[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	last := strings.TrimSpace(v[start:])
+	if len(last) > 0 {
+		elems = append(elems, last)
+	}
+	for _, e := range elems {
+		if len(e) == 0 {
+			return nil, errutil.New(ErrInvalidList,
+				errutil.MoreInfo, "empty element", "value", v)
+		}
+	}
+	return elems, nil
+}
+
+// splitMap splits map value such as "k1:v1, k2:v2" into keys and values.
+// entries are separated the same way as list.
+func splitMap(v string) ([]string, []string, error) {
+	entries, err := splitList(v)
+	if err != nil {
+		return nil, nil, errutil.Embed(ErrInvalidMap, err, "value", v)
+	}
+	keys := make([]string, len(entries))
+	values := make([]string, len(entries))
+	for i, e := range entries {
+		k := strings.Index(e, ":")
+		if k < 0 {
+			return nil, nil, errutil.New(ErrInvalidMap,
+				errutil.MoreInfo, "no : in entry",
+				"entry", e, "value", v)
 		}
+		keys[i] = strings.TrimSpace(e[:k])
+		values[i] = strings.TrimSpace(e[k+1:])
 	}
-	unit := m[4]
-	return true, i, dexists, d, unit
+	return keys, values, nil
 }
 
 func DecomposeSRTableReference(v string) (string, string) {
@@ -328,6 +603,16 @@ func DecomposeSRTableReference(v string) (string, string) {
 	return tName, fName
 }
 
+// DecomposeRowReference splits v such as Item[Sword].atk into
+// table name, row key and field name.
+func DecomposeRowReference(v string) (string, string, string) {
+	m := reRowReference.FindStringSubmatch(v)
+	if m == nil {
+		return "", "", ""
+	}
+	return m[1], strings.TrimSpace(m[2]), m[3]
+}
+
 /////////////////////////////////////////////////////////////////////
 
 func init() {
@@ -341,22 +626,38 @@ func init() {
 	ErrInvalidInt = errors.New("잘못된 int")
 	ErrInvalidSRTableReference = errors.New("잘못된 SRTable 레퍼런스")
 	ErrIntOutOfRange = errors.New("int값이 범위를 벗어남")
+	ErrInvalidBool = errors.New("잘못된 bool")
+	ErrInvalidFloat = errors.New("잘못된 float")
+	ErrFloatOutOfRange = errors.New("float값이 범위를 벗어남")
+	ErrInvalidEnum = errors.New("enum에 없는 값")
+	ErrInvalidList = errors.New("잘못된 list")
+	ErrInvalidMap = errors.New("잘못된 map")
+	ErrInvalidString = errors.New("잘못된 string")
 	ErrNotAutoKey = errors.New("심볼이 autokey가 아님")
 	ErrKeyOutOfRange = errors.New("지정된 테이블에 있는 키가 아님")
 	ErrCyclicDependency = errors.New("cyclic dependency")
+	ErrDuplicateValue = errors.New("값이 중복")
+	ErrNotCovered = errors.New("$coverall 필드에 빠진 키가 있음")
+	ErrDuplicateKey = errors.New("키가 중복")
 
 	reSRTableReference, _ = regexp.Compile(
 		`^([A-Za-z][0-9A-Za-z_]*)(\.(.+))$`)
+	reRowReference, _ = regexp.Compile(
+		`^([A-Za-z][0-9A-Za-z_]*)\[([^\[\]]+)\]\.(.+)$`)
 	reValueWithUnit, _ = regexp.Compile(
-		`^([0-9]+)(\.([0-9]{1,4}))?\s*([A-Za-z][0-9A-Za-z_]*)?$` )
+		`^([-+])?([0-9]+)(\.([0-9]{1,4}))?\s*([A-Za-z][0-9A-Za-z_]*)?$` )
+	reFloatWithUnit, _ = regexp.Compile(
+		`^([-+]?([0-9]+\.?[0-9]*|\.[0-9]+)([eE][-+]?[0-9]+)?)\s*([A-Za-z][0-9A-Za-z_]*)?$` )
 
-	tableOpts1 = []string{ kwTblOptPartial, kwTblOptSingleRow }
+	tableOpts1 = []string{ kwTblOptPartial, kwTblOptSingleRow, kwTblOptSorted }
 	tableOpts2 = []string{}
-	tableOpts3 = []string{}
+	tableOpts3 = []string{ kwTblOptUnique, kwTblOptKeys }
 }
 
 var (
 	reSRTableReference *regexp.Regexp
+	reRowReference     *regexp.Regexp
 	reValueWithUnit    *regexp.Regexp
+	reFloatWithUnit    *regexp.Regexp
 )
 var tableOpts1, tableOpts2, tableOpts3 []string
@@ -0,0 +1,183 @@
+package nparamcli
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitList(t *testing.T) {
+	tests := []struct {
+		v     string
+		want  []string
+		err   error
+	}{
+		{ "", nil, nil },
+		{ "  ", nil, nil },
+		{ "a", []string{ "a" }, nil },
+		{ "a,b", []string{ "a", "b" }, nil },
+		{ "a;b", []string{ "a", "b" }, nil },
+		{ " a , b ;c", []string{ "a", "b", "c" }, nil },
+		{ "a,b,", []string{ "a", "b" }, nil },
+		{ "a;", []string{ "a" }, nil },
+		// separators inside parentheses are of expressions
+		{ "min(A, B), max(1; 2) * 2", []string{ "min(A, B)", "max(1; 2) * 2" }, nil },
+		{ "k1: min(A, B), k2: 3", []string{ "k1: min(A, B)", "k2: 3" }, nil },
+		{ "a) , b", []string{ "a)", "b" }, nil },
+		{ "a,,b", nil, ErrInvalidList },
+		{ "a, ;b", nil, ErrInvalidList },
+		{ ",a", nil, ErrInvalidList },
+		{ ",", nil, ErrInvalidList },
+	}
+	for _, tt := range tests {
+		got, err := splitList(tt.v)
+		if tt.err != nil {
+			if err == nil || ! strings.Contains(err.Error(), tt.err.Error()) {
+				t.Errorf("splitList(%q): error %v, want %v", tt.v, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || ! reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitList(%q) = %q, %v, want %q", tt.v, got, err, tt.want)
+		}
+	}
+}
+
+func TestSplitMap(t *testing.T) {
+	tests := []struct {
+		v      string
+		keys   []string
+		values []string
+		err    error
+	}{
+		{ "", []string{}, []string{}, nil },
+		{ "a:1", []string{ "a" }, []string{ "1" }, nil },
+		{ "a : 1, b:2; c :3,", []string{ "a", "b", "c" }, []string{ "1", "2", "3" }, nil },
+		{ "a:", []string{ "a" }, []string{ "" }, nil },
+		{ "a: x:y", []string{ "a" }, []string{ "x:y" }, nil },
+		{ "a:1,,b:2", nil, nil, ErrInvalidMap },
+		{ "a:1;b", nil, nil, ErrInvalidMap },
+	}
+	for _, tt := range tests {
+		keys, values, err := splitMap(tt.v)
+		if tt.err != nil {
+			if err == nil || ! strings.Contains(err.Error(), tt.err.Error()) {
+				t.Errorf("splitMap(%q): error %v, want %v", tt.v, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || ! reflect.DeepEqual(keys, tt.keys) ||
+			! reflect.DeepEqual(values, tt.values) {
+			t.Errorf("splitMap(%q) = %q, %q, %v, want %q, %q",
+				tt.v, keys, values, err, tt.keys, tt.values)
+		}
+	}
+}
+
+func buildTestTableMeta(tOptStr string, fNames, fOptStrs []string) (*tableMeta, error) {
+	tOpts, err := GetTableOpts(tOptStr)
+	if err != nil {
+		return nil, err
+	}
+	return BuildTableMeta("T", "test", "", tOpts, fNames, fOptStrs)
+}
+
+func TestBuildTableMetaKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		tOptStr  string
+		fNames   []string
+		fOptStrs []string
+		err      error
+	}{
+		{
+			name:     "int key",
+			fNames:   []string{ "id", "v" },
+			fOptStrs: []string{ "$int", "$string" },
+		},
+		{
+			name:     "string key",
+			fNames:   []string{ "name", "v" },
+			fOptStrs: []string{ "$string", "$int" },
+			err:      ErrInvalidFieldDef,
+		},
+		{
+			name:     "composite key not in the first column",
+			tOptStr:  "$keys=a,b",
+			fNames:   []string{ "name", "a", "b" },
+			fOptStrs: []string{ "$string", "$int", "$enum=X,Y" },
+		},
+		{
+			name:     "optional first column with composite key",
+			tOptStr:  "$keys=a,b",
+			fNames:   []string{ "a", "b", "desc" },
+			fOptStrs: []string{ "$int", "$int", "$string;$optional" },
+		},
+		{
+			name:     "composite key of string",
+			tOptStr:  "$keys=name,a",
+			fNames:   []string{ "name", "a" },
+			fOptStrs: []string{ "$string", "$int" },
+			err:      ErrTableOpts,
+		},
+		{
+			name:     "optional composite key",
+			tOptStr:  "$keys=a,b",
+			fNames:   []string{ "a", "b" },
+			fOptStrs: []string{ "$int;$optional", "$int" },
+			err:      ErrTableOpts,
+		},
+		{
+			name:     "single composite key",
+			tOptStr:  "$keys=a",
+			fNames:   []string{ "a", "b" },
+			fOptStrs: []string{ "$int", "$int" },
+			err:      ErrTableOpts,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := buildTestTableMeta(tt.tOptStr, tt.fNames, tt.fOptStrs)
+			if tt.err == nil {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || ! strings.Contains(err.Error(), tt.err.Error()) {
+				t.Errorf("error %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestRowKey(t *testing.T) {
+	tm, err := buildTestTableMeta("",
+		[]string{ "id", "v" }, []string{ "$keysof=Item", "$int" })
+	if err != nil {
+		t.Fatal(err)
+	}
+	td := &tableData{
+		tableMeta: tm,
+		RawData: [][]string{ {"Sword", "1"} },
+		Data: [][]int{ {1001, 1} },
+	}
+	if got := td.rowKey(0); got != "Sword" {
+		t.Errorf("id key %q", got)
+	}
+
+	tm, err = buildTestTableMeta("$keys=a,c",
+		[]string{ "name", "a", "c" },
+		[]string{ "$string", "$keysof=Item", "$enum=Red,Blue" })
+	if err != nil {
+		t.Fatal(err)
+	}
+	td = &tableData{
+		tableMeta: tm,
+		RawData: [][]string{ {"x", "Item_A", "Blue"} },
+		Data: [][]int{ {0, 1001, 1} },
+	}
+	if got := td.rowKey(0); got != "1001,1" {
+		t.Errorf("composite key %q", got)
+	}
+}
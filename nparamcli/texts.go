@@ -0,0 +1,323 @@
+package nparamcli
+
+// $text values are localized. each text cell gets a key such as
+// Item.Sword.desc (table, row key, field), and .pb.bin of the table has
+// only the key. texts are written per locale as a separate table of
+// key and text, which the loaders look up by key.
+//
+// texts of TextLocale, i.e. the source language, are exported to
+// Outputs/<package>_text.<locale>.yaml for translators.
+// translations of each of Locales are read from Texts/<locale>.yaml,
+// and the source text is used where translation is missing or stale,
+// i.e. translated from a different source text.
+
+import (
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/bluegol/errutil"
+	"github.com/golang/protobuf/proto"
+)
+
+const (
+	textDir = "Texts/"
+	defaultTextLocale = "en"
+)
+
+type textEntry struct {
+	Key    string
+	Text   string
+	Table  string
+	RowKey string
+	Field  string
+	// location of the row
+	Loc    string
+}
+
+// translation is a translated text, with the source text it was
+// translated from.
+type translation struct {
+	Source string
+	Text   string
+}
+
+func translationFileName(locale string) string {
+	return textDir + locale + ".yaml"
+}
+
+func textExportFileName(packageName, locale string) string {
+	return outputDir + packageName + "_text." + locale + ".yaml"
+}
+
+func textBinFileName(packageName, locale string) string {
+	return outputDir + packageName + "_text." + locale + extBin
+}
+
+func textProtoFileName(packageName string) string {
+	return outputDir + packageName + "_text" + extProto
+}
+
+// TextKey returns the key of localized text. rowKey is empty for
+// single-row table, and column is the field name such as reward[0].desc.
+func TextKey(tableName, rowKey, column string) string {
+	if len(rowKey) == 0 {
+		return tableName + "." + column
+	}
+	return tableName + "." + rowKey + "." + column
+}
+
+func (t *tableMeta) hasText() bool {
+	for _, fi := range t.fieldsByOrder {
+		if fi.Type == vtText {
+			return true
+		}
+	}
+	return false
+}
+
+// textLines returns lines of raw data with text values replaced by
+// their keys, and the texts. empty texts don't have keys.
+// RawData itself is returned if the table has no text field.
+func (td *tableData) textLines() ([][]string, []*textEntry) {
+	if ! td.hasText() {
+		return td.RawData, nil
+	}
+
+	columns := make([]string, len(td.fieldsByOrder))
+	for name, o := range td.fieldsNameAndOrder {
+		columns[o] = name
+	}
+	lines := make([][]string, len(td.RawData))
+	entries := []*textEntry{}
+	for i, rawLine := range td.RawData {
+		rowKey := ""
+		if ! td.SingleRow {
+			rowKey = td.rowKey(i)
+		}
+		line := make([]string, len(rawLine))
+		copy(line, rawLine)
+		for j, fi := range td.fieldsByOrder {
+			if fi.Type != vtText {
+				continue
+			}
+			addEntry := func(column, text string) string {
+				key := TextKey(td.Name, rowKey, column)
+				entries = append(entries, &textEntry{
+					Key: key, Text: text,
+					Table: td.Name, RowKey: rowKey, Field: column,
+					Loc: td.RowLoc(i) })
+				return key
+			}
+			if fi.List {
+				// already checked when resolved
+				texts, _ := splitList(rawLine[j])
+				keys := make([]string, len(texts))
+				for k, text := range texts {
+					keys[k] = addEntry(columns[j] + "[" + strconv.Itoa(k) + "]", text)
+				}
+				line[j] = strings.Join(keys, ", ")
+				continue
+			}
+			text := rawLine[j]
+			if len(text) == 0 && ! fi.Optional {
+				text = fi.DefaultStr
+			}
+			if len(text) == 0 {
+				line[j] = ""
+				continue
+			}
+			line[j] = addEntry(columns[j], text)
+		}
+		lines[i] = line
+	}
+	return lines, entries
+}
+
+/////////////////////////////////////////////////////////////////////
+
+// generateTexts writes the source language export and the text
+// table of each locale.
+func (proc *processor) generateTexts() error {
+	time.Sleep(time.Second)
+	proc.logger.Info("generating texts...")
+
+	// texts of all tables, sorted by table name
+	tNames := []string{}
+	for tName, tm := range proc.tms {
+		if tm.hasText() {
+			tNames = append(tNames, tName)
+		}
+	}
+	if len(tNames) == 0 {
+		proc.logger.Info("...no text")
+		return nil
+	}
+	sort.Strings(tNames)
+	proc.texts = []*textEntry{}
+	for _, tName := range tNames {
+		_, entries := proc.tds[tName].textLines()
+		proc.texts = append(proc.texts, entries...)
+	}
+
+	pkg := proc.config.ProtoPackage
+	srcLocale := proc.config.TextLocale
+	outs := []string{ textExportFileName(pkg, srcLocale),
+		textBinFileName(pkg, srcLocale) }
+	for _, locale := range proc.config.Locales {
+		outs = append(outs, textBinFileName(pkg, locale))
+	}
+	needToProcess := proc.tableListChanged
+	for _, tName := range tNames {
+		rtdFn := ChangeExt(proc.tms[tName].TmFileName, extResolvedTableData)
+		for _, out := range outs {
+			if NeedToProcess(rtdFn, out) {
+				needToProcess = true
+			}
+		}
+	}
+
+	// source language
+	if needToProcess {
+		exportFn := textExportFileName(pkg, srcLocale)
+		err := WriteYamlFile(exportFn, proc.texts)
+		if err != nil {
+			return err
+		}
+		proc.logger.Info("exported texts", "file", exportFn)
+
+		texts := make([]string, len(proc.texts))
+		for k, e := range proc.texts {
+			texts[k] = e.Text
+		}
+		err = proc.writeTextBin(srcLocale, texts)
+		if err != nil {
+			return err
+		}
+	}
+
+	// translations
+	for _, locale := range proc.config.Locales {
+		trFn := translationFileName(locale)
+		if ! needToProcess && ! NeedToProcess(trFn, textBinFileName(pkg, locale)) {
+			continue
+		}
+		translations := map[string]*translation{}
+		err := ReadYamlFile(trFn, &translations)
+		if err != nil && ! errutil.IsNotExist(err) {
+			return err
+		}
+		texts := make([]string, len(proc.texts))
+		missing, stale := []string{}, []string{}
+		for k, e := range proc.texts {
+			tr := translations[e.Key]
+			if tr == nil || len(tr.Text) == 0 {
+				texts[k] = e.Text
+				missing = append(missing, e.Key)
+			} else if tr.Source != e.Text {
+				texts[k] = e.Text
+				stale = append(stale, e.Key)
+			} else {
+				texts[k] = tr.Text
+			}
+		}
+		if len(missing) > 0 {
+			proc.logger.Warn("missing translations. source texts are used",
+				"locale", locale, "count", len(missing),
+				"keys", strings.Join(missing, " "))
+		}
+		if len(stale) > 0 {
+			proc.logger.Warn("stale translations. source texts are used",
+				"locale", locale, "count", len(stale),
+				"keys", strings.Join(stale, " "))
+		}
+		err = proc.writeTextBin(locale, texts)
+		if err != nil {
+			return err
+		}
+	}
+
+	proc.logger.Info("...finished generating texts")
+	return nil
+}
+
+// writeTextBin writes texts of the locale, in the same format as
+// table data, i.e. each key and text is an element of repeated data = 1.
+func (proc *processor) writeTextBin(locale string, texts []string) error {
+	binFn := textBinFileName(proc.config.ProtoPackage, locale)
+	pb := proto.NewBuffer(nil)
+	entry := proto.NewBuffer(nil)
+	for k, e := range proc.texts {
+		entry.Reset()
+		entry.EncodeVarint( uint64(1)<<3 | proto.WireBytes )
+		entry.EncodeStringBytes(e.Key)
+		entry.EncodeVarint( uint64(2)<<3 | proto.WireBytes )
+		entry.EncodeStringBytes(texts[k])
+		pb.EncodeVarint( uint64(1)<<3 | proto.WireBytes )
+		pb.EncodeRawBytes(entry.Bytes())
+	}
+	f, err := os.Create(binFn)
+	if err != nil {
+		return errutil.AddInfo(err, "locale", locale)
+	}
+	_, err = f.Write(pb.Bytes())
+	if err == nil {
+		err = f.Close()
+	} else {
+		f.Close()
+	}
+	if err != nil {
+		os.Remove(binFn)
+		return errutil.AddInfo(err, "locale", locale)
+	}
+	proc.logger.Info("generated texts", "locale", locale, "file", binFn)
+	return nil
+}
+
+// writeTextProto writes the proto of text tables, if there's any text.
+func (proc *processor) writeTextProto() error {
+	if proc.texts == nil {
+		return nil
+	}
+	tmpl := template.Must(
+		template.New("textProto").
+		Funcs(template.FuncMap{
+			"protoPackage": func() string {
+				return proc.config.ProtoPackage
+			},
+			"protoTypePrefix" : func() string {
+				return proc.config.ProtoTypePrefix
+			},
+		}).
+		Parse(textProtoTmplStr))
+
+	protoFn := textProtoFileName(proc.config.ProtoPackage)
+	_, err := os.Stat(protoFn)
+	if err != nil || proc.tableListChanged {
+		err = ExecuteTemplateToFile(protoFn, tmpl, nil)
+		if err != nil {
+			os.Remove(protoFn)
+			return err
+		}
+		proc.logger.Info("created proto file for texts", "file", protoFn)
+	}
+	proc.protoFns = append(proc.protoFns, protoFn)
+	return nil
+}
+
+const textProtoTmplStr = `
+{{- "syntax = "}}"proto3";
+package {{ protoPackage }};
+
+message {{ protoTypePrefix }}LocalizedText {
+	string key = 1;
+	string text = 2;
+}
+
+message Data_{{ protoTypePrefix }}LocalizedText {
+	repeated {{ protoTypePrefix }}LocalizedText data = 1;
+}
+`
@@ -0,0 +1,220 @@
+package nparamcli
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	log "gopkg.in/inconshreveable/log15.v2"
+)
+
+func TestTextKey(t *testing.T) {
+	tests := []struct {
+		table, rowKey, column string
+		want                  string
+	}{
+		{ "Item", "Sword", "desc", "Item.Sword.desc" },
+		{ "Item", "3", "desc", "Item.3.desc" },
+		{ "Item", "Sword", "reward[1].desc", "Item.Sword.reward[1].desc" },
+		{ "Config", "", "title", "Config.title" },
+	}
+	for _, tt := range tests {
+		got := TextKey(tt.table, tt.rowKey, tt.column)
+		if got != tt.want {
+			t.Errorf("TextKey(%q, %q, %q) = %q, want %q",
+				tt.table, tt.rowKey, tt.column, got, tt.want)
+		}
+	}
+}
+
+// buildTestTextTable returns table data with raw data lines.
+func buildTestTextTable(t *testing.T, name, tOptStr string,
+	fNames, fOptStrs []string, lines [][]string) *tableData {
+
+	t.Helper()
+	tOpts, err := GetTableOpts(tOptStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tm, err := BuildTableMeta(name, "test", "", tOpts, fNames, fOptStrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &tableData{ Name: name, tableMeta: tm, RawData: lines }
+}
+
+func TestTextLines(t *testing.T) {
+	tests := []struct {
+		name  string
+		td    *tableData
+		data  [][]int
+		lines [][]string
+		keys  []string
+	}{
+		{
+			name: "autokey",
+			td: buildTestTextTable(t, "Item", "",
+				[]string{ "id", "name", "n", "desc[0]", "desc[1]", "note" },
+				[]string{ "$autokey", "$text", "$int", "$text", "$text",
+					"$text;$default=None" },
+				[][]string{
+					{ "Sword", "Sword", "1", "sharp", "", "" },
+					{ "Bow", "", "2", "long", "far", "ok" },
+				}),
+			lines: [][]string{
+				{ "Sword", "Item.Sword.name", "1", "Item.Sword.desc[0]", "",
+					"Item.Sword.note" },
+				{ "Bow", "", "2", "Item.Bow.desc[0]", "Item.Bow.desc[1]",
+					"Item.Bow.note" },
+			},
+			keys: []string{
+				"Item.Sword.name", "Item.Sword.desc[0]", "Item.Sword.note",
+				"Item.Bow.desc[0]", "Item.Bow.desc[1]", "Item.Bow.note",
+			},
+		},
+		{
+			name: "int key and list",
+			td: buildTestTextTable(t, "Quest", "",
+				[]string{ "id", "lines" },
+				[]string{ "$int", "$text;$list" },
+				[][]string{
+					{ "0x10", "hi, bye" },
+					{ "3", "" },
+				}),
+			data: [][]int{ { 16, 0 }, { 3, 0 } },
+			lines: [][]string{
+				{ "0x10", "Quest.16.lines[0], Quest.16.lines[1]" },
+				{ "3", "" },
+			},
+			keys: []string{ "Quest.16.lines[0]", "Quest.16.lines[1]" },
+		},
+		{
+			name: "single-row",
+			td: buildTestTextTable(t, "Config", "$singlerow",
+				[]string{ "id", "title" },
+				[]string{ "$int", "$text" },
+				[][]string{ { "1", "Game" } }),
+			data:  [][]int{ { 1, 0 } },
+			lines: [][]string{ { "1", "Config.title" } },
+			keys:  []string{ "Config.title" },
+		},
+		{
+			name: "no text",
+			td: buildTestTextTable(t, "Plain", "",
+				[]string{ "id", "s" },
+				[]string{ "$autokey", "$string" },
+				[][]string{ { "A", "a" } }),
+			lines: [][]string{ { "A", "a" } },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.td.Data = tt.data
+			lines, entries := tt.td.textLines()
+			if ! reflect.DeepEqual(lines, tt.lines) {
+				t.Errorf("lines %q, want %q", lines, tt.lines)
+			}
+			keys := []string{}
+			for _, e := range entries {
+				keys = append(keys, e.Key)
+			}
+			if len(keys) != len(tt.keys) ||
+				(len(keys) > 0 && ! reflect.DeepEqual(keys, tt.keys)) {
+				t.Errorf("keys %q, want %q", keys, tt.keys)
+			}
+		})
+	}
+}
+
+func TestGenerateTexts(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chdir(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	err = initPath()
+	if err == nil {
+		err = os.MkdirAll(textDir, os.ModePerm)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Item.Bow.name is missing, Item.Axe.name is empty, and
+	// Item.Mace.name is translated from old source text
+	err = os.WriteFile(translationFileName("ko"), []byte(
+		"Item.Sword.name:\n  source: Sword\n  text: 검\n" +
+		"Item.Axe.name:\n  source: Axe\n  text: \"\"\n" +
+		"Item.Mace.name:\n  source: Club\n  text: 곤봉\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	td := buildTestTextTable(t, "Item", "",
+		[]string{ "id", "name" },
+		[]string{ "$autokey", "$text" },
+		[][]string{ { "Sword", "Sword" }, { "Bow", "Bow" }, { "Axe", "Axe" },
+			{ "Mace", "Mace" } })
+	td.TmFileName = workDir + "Item" + extTableMeta
+	err = os.WriteFile(ChangeExt(td.TmFileName, extResolvedTableData), nil, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proc := &processor{
+		logger: log.New(),
+		config: &config{ ProtoPackage: "game", TextLocale: "en",
+			Locales: []string{ "ko" } },
+		tms: map[string]*tableMeta{ "Item": td.tableMeta },
+		tds: map[string]*tableData{ "Item": td },
+		tableListChanged: true,
+	}
+	err = proc.generateTexts()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// LocalizedText is key = 1, text = 2, as an element of data = 1
+	entry := func(key, text string) testPbField {
+		return testPbField{ tag: 1, wt: proto.WireBytes, sub: []testPbField{
+			{ tag: 1, wt: proto.WireBytes, data: key },
+			{ tag: 2, wt: proto.WireBytes, data: text },
+		} }
+	}
+	for _, tt := range []struct {
+		locale string
+		want   []testPbField
+	}{
+		{ "en", []testPbField{
+			entry("Item.Sword.name", "Sword"),
+			entry("Item.Bow.name", "Bow"),
+			entry("Item.Axe.name", "Axe"),
+			entry("Item.Mace.name", "Mace"),
+		} },
+		{ "ko", []testPbField{
+			entry("Item.Sword.name", "검"),
+			entry("Item.Bow.name", "Bow"),
+			entry("Item.Axe.name", "Axe"),
+			entry("Item.Mace.name", "Mace"),
+		} },
+	} {
+		b, err := os.ReadFile(textBinFileName("game", tt.locale))
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkTestPb(t, tt.locale, b, tt.want)
+	}
+
+	exported := []*textEntry{}
+	err = ReadYamlFile(textExportFileName("game", "en"), &exported)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(exported) != 4 || *exported[1] != (textEntry{ Key: "Item.Bow.name",
+		Text: "Bow", Table: "Item", RowKey: "Bow", Field: "name" }) {
+		t.Errorf("exported %v", exported)
+	}
+}
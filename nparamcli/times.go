@@ -0,0 +1,152 @@
+package nparamcli
+
+// $duration and $datetime values are kept as int of milliseconds.
+// duration is written as in go, such as 1h30m, 250ms or -1.5s, and
+// days such as 2d12h are also allowed. sign is only at the beginning.
+// datetime is ISO-8601 such as 2016-05-17T10:00:00+09:00, or excel's date
+// serial such as 42507.5. if time zone is not given, config's time zone
+// is used. it is milliseconds since unix epoch.
+
+import (
+	"errors"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bluegol/errutil"
+)
+
+var (
+	ErrInvalidDuration error
+	ErrInvalidDatetime error
+	ErrTimeOutOfRange error
+)
+
+// layouts of datetime with time zone
+var datetimeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04Z07:00",
+}
+// layouts of datetime without time zone
+var localDatetimeLayouts = []string{
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// excel's day 0. 1900-02-29, which excel regards as a valid date,
+// is not taken into account, so serials before 1900-03-01 are off by one.
+var excelEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// ParseDuration returns milliseconds of duration v.
+func ParseDuration(v string) (int, error) {
+	s := strings.TrimSpace(v)
+	var days int64
+	m := reDurationDays.FindStringSubmatch(s)
+	if m != nil {
+		var err error
+		days, err = strconv.ParseInt(m[2], 10, 64)
+		if err != nil || days > math.MaxInt64 / int64(24*time.Hour) {
+			return 0, errutil.New(ErrInvalidDuration,
+				errutil.MoreInfo, "out of range", "value", v)
+		}
+		if m[1] == "-" {
+			days = -days
+		}
+		// sign applies to the whole duration, such as -2d12h
+		if strings.HasPrefix(m[3], "-") || strings.HasPrefix(m[3], "+") {
+			return 0, errutil.New(ErrInvalidDuration,
+				errutil.MoreInfo, "sign after days", "value", v)
+		}
+		s = m[1] + m[3]
+		if len(m[3]) == 0 {
+			s = "0"
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, errutil.Embed(ErrInvalidDuration, err, "value", v)
+	}
+	if d % time.Millisecond != 0 {
+		return 0, errutil.New(ErrInvalidDuration,
+			errutil.MoreInfo, "resolution is millisecond", "value", v)
+	}
+	dayMs := days * int64(24*time.Hour/time.Millisecond)
+	ms := int64(d / time.Millisecond)
+	if (dayMs > 0 && ms > math.MaxInt64 - dayMs) ||
+		(dayMs < 0 && ms < math.MinInt64 - dayMs) {
+		return 0, errutil.New(ErrInvalidDuration,
+			errutil.MoreInfo, "out of range", "value", v)
+	}
+	return int(dayMs + ms), nil
+}
+
+// ParseDatetime returns milliseconds since unix epoch of datetime v.
+// loc is used if v doesn't have time zone.
+func ParseDatetime(v string, loc *time.Location) (int, error) {
+	s := strings.TrimSpace(v)
+	for _, layout := range datetimeLayouts {
+		t, err := time.Parse(layout, s)
+		if err == nil {
+			return datetimeMs(v, t)
+		}
+	}
+	for _, layout := range localDatetimeLayouts {
+		t, err := time.ParseInLocation(layout, s, loc)
+		if err == nil {
+			return datetimeMs(v, t)
+		}
+	}
+
+	// excel date serial
+	serial, err := strconv.ParseFloat(s, 64)
+	if err != nil || serial < 0 || serial > excelMaxSerial {
+		return 0, errutil.New(ErrInvalidDatetime, "value", v)
+	}
+	// serial is wall clock time in loc
+	day := math.Floor(serial)
+	ms := int64(math.Round((serial - day) * float64(24*time.Hour/time.Millisecond)))
+	wall := excelEpoch.AddDate(0, 0, int(day)).
+		Add(time.Duration(ms) * time.Millisecond)
+	t := time.Date(wall.Year(), wall.Month(), wall.Day(),
+		wall.Hour(), wall.Minute(), wall.Second(), wall.Nanosecond(), loc)
+	return datetimeMs(v, t)
+}
+
+// 9999-12-31
+const excelMaxSerial = 2958465
+
+func datetimeMs(v string, t time.Time) (int, error) {
+	if t.Nanosecond() % int(time.Millisecond) != 0 {
+		return 0, errutil.New(ErrInvalidDatetime,
+			errutil.MoreInfo, "resolution is millisecond", "value", v)
+	}
+	return int(t.Unix()*1000 + int64(t.Nanosecond()/int(time.Millisecond))), nil
+}
+
+// timeMessage returns seconds and nanos of google.protobuf.Duration or
+// Timestamp for ms. nanos of Timestamp must not be negative, while
+// nanos of Duration has the same sign as seconds.
+func timeMessage(t int, ms int) (int64, int32) {
+	sec := int64(ms / 1000)
+	rem := int64(ms % 1000)
+	if t == vtDatetime && rem < 0 {
+		sec--
+		rem += 1000
+	}
+	return sec, int32(rem * int64(time.Millisecond))
+}
+
+func init() {
+	ErrInvalidDuration = errors.New("잘못된 duration")
+	ErrInvalidDatetime = errors.New("잘못된 datetime")
+	ErrTimeOutOfRange = errors.New("duration 또는 datetime값이 범위를 벗어남")
+
+	reDurationDays, _ = regexp.Compile(`^([-+]?)([0-9]+)d(.*)$`)
+}
+
+var reDurationDays *regexp.Regexp
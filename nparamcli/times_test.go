@@ -0,0 +1,115 @@
+package nparamcli
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		v     string
+		want  int
+		err   bool
+	}{
+		{ "0", 0, false },
+		{ "250ms", 250, false },
+		{ "1h30m", 5400000, false },
+		{ "-1.5s", -1500, false },
+		{ " 2s ", 2000, false },
+		{ "1d", 86400000, false },
+		{ "2d12h", 216000000, false },
+		{ "-2d12h", -216000000, false },
+		{ "+1d1ms", 86400001, false },
+		{ "2d-12h", 0, true },
+		{ "2d+12h", 0, true },
+		{ "-2d-12h", 0, true },
+		{ "1us", 0, true },
+		{ "1.5", 0, true },
+		{ "d", 0, true },
+		{ "106751991167d", 0, true },
+		{ "", 0, true },
+	}
+	for _, tt := range tests {
+		got, err := ParseDuration(tt.v)
+		if tt.err {
+			if err == nil ||
+				! strings.Contains(err.Error(), ErrInvalidDuration.Error()) {
+				t.Errorf("ParseDuration(%q): error %v, want %v",
+					tt.v, err, ErrInvalidDuration)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseDuration(%q) = %d, %v, want %d", tt.v, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseDatetime(t *testing.T) {
+	seoul := time.FixedZone("KST", 9*60*60)
+	ms := func(tm time.Time) int {
+		return int(tm.UnixNano() / int64(time.Millisecond))
+	}
+	tests := []struct {
+		v     string
+		want  int
+		err   bool
+	}{
+		{ "2016-05-17T10:00:00+09:00", ms(time.Date(2016, 5, 17, 1, 0, 0, 0, time.UTC)), false },
+		{ "2016-05-17T10:00:00Z", ms(time.Date(2016, 5, 17, 10, 0, 0, 0, time.UTC)), false },
+		{ "2016-05-17T10:00:00.5Z", ms(time.Date(2016, 5, 17, 10, 0, 0, 5e8, time.UTC)), false },
+		{ "2016-05-17T10:00Z", ms(time.Date(2016, 5, 17, 10, 0, 0, 0, time.UTC)), false },
+		{ "2016-05-17T10:00:00", ms(time.Date(2016, 5, 17, 10, 0, 0, 0, seoul)), false },
+		{ "2016-05-17 10:00", ms(time.Date(2016, 5, 17, 10, 0, 0, 0, seoul)), false },
+		{ "2016-05-17", ms(time.Date(2016, 5, 17, 0, 0, 0, 0, seoul)), false },
+		{ "1969-12-31T23:59:59.999Z", -1, false },
+		{ "42507.5", ms(time.Date(2016, 5, 17, 12, 0, 0, 0, seoul)), false },
+		{ "42507", ms(time.Date(2016, 5, 17, 0, 0, 0, 0, seoul)), false },
+		{ "2016-05-17T10:00:00.0000001Z", 0, true },
+		{ "10/17/26", 0, true },
+		{ "-1", 0, true },
+		{ "2958466", 0, true },
+		{ "", 0, true },
+	}
+	for _, tt := range tests {
+		got, err := ParseDatetime(tt.v, seoul)
+		if tt.err {
+			if err == nil ||
+				! strings.Contains(err.Error(), ErrInvalidDatetime.Error()) {
+				t.Errorf("ParseDatetime(%q): error %v, want %v",
+					tt.v, err, ErrInvalidDatetime)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseDatetime(%q) = %d, %v, want %d", tt.v, got, err, tt.want)
+		}
+	}
+}
+
+func TestIsDateFormat(t *testing.T) {
+	tests := []struct {
+		f     string
+		want  bool
+	}{
+		{ "General", false },
+		{ "0.00", false },
+		{ "#,##0", false },
+		{ "0.00E+00", false },
+		{ "m/d/yy", true },
+		{ "yyyy-mm-dd hh:mm:ss", true },
+		{ "[$-409]h:mm AM/PM", true },
+		{ "[h]:mm", true },
+		{ "[Red]0.00", false },
+		{ `0.00" days"`, false },
+		{ `0\d`, false },
+		{ "_(* #,##0_)", false },
+	}
+	for _, tt := range tests {
+		got := isDateFormat(tt.f)
+		if got != tt.want {
+			t.Errorf("isDateFormat(%q) = %v, want %v", tt.f, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,468 @@
+package nparamcli
+
+// texts are exported for translators as XLIFF 1.2 (.xlf, .xliff) or
+// gettext PO (.po) file, with the context of each text, i.e. table,
+// row key, field and location. key of text is the id of XLIFF
+// trans-unit, or msgctxt of PO entry.
+// translated file is imported into Texts/<locale>.yaml, and
+// the text tables are rebuilt.
+
+import (
+	"bufio"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/bluegol/errutil"
+	log "gopkg.in/inconshreveable/log15.v2"
+)
+
+var (
+	ErrUnknownLocale error
+	ErrInvalidTranslationFile error
+)
+
+const (
+	extXliff = ".xliff"
+	extXlf = ".xlf"
+	extPo = ".po"
+)
+
+// transUnit is a text to be translated, or a translated text.
+type transUnit struct {
+	Key    string
+	Source string
+	Target string
+	// Stale is set if Target was translated from different source.
+	Stale  bool
+	// for export only
+	Entry  *textEntry
+}
+
+func ExportTexts(locale, fn string, warn bool) error {
+	return exportTexts(configFileName(), locale, fn, warn)
+}
+
+func ImportTexts(locale, fn string, warn bool) error {
+	return importTexts(configFileName(), locale, fn, warn)
+}
+
+// exportTexts builds, and then writes texts to be translated into locale,
+// with their translations so far.
+func exportTexts(configFilename, locale, fn string, warn bool) error {
+	err := checkTranslationFileName(fn)
+	if err != nil {
+		return err
+	}
+	err = process(configFilename, false, warn)
+	if err != nil {
+		return err
+	}
+	c, err := loadTranslationConfig(configFilename, locale)
+	if err != nil {
+		return err
+	}
+
+	entries := []*textEntry{}
+	err = ReadYamlFile(textExportFileName(c.ProtoPackage, c.TextLocale), &entries)
+	if err != nil && ! errutil.IsNotExist(err) {
+		return err
+	}
+	translations := map[string]*translation{}
+	err = ReadYamlFile(translationFileName(locale), &translations)
+	if err != nil && ! errutil.IsNotExist(err) {
+		return err
+	}
+	units := make([]*transUnit, len(entries))
+	for k, e := range entries {
+		u := &transUnit{ Key: e.Key, Source: e.Text, Entry: e }
+		tr := translations[e.Key]
+		if tr != nil {
+			u.Target = tr.Text
+			u.Stale = tr.Source != e.Text
+		}
+		units[k] = u
+	}
+
+	f, err := os.Create(fn)
+	if err != nil {
+		return err
+	}
+	if translationFileExt(fn) == extPo {
+		err = writePo(f, c.TextLocale, locale, units)
+	} else {
+		err = writeXliff(f, c.ProtoPackage, c.TextLocale, locale, units)
+	}
+	if err == nil {
+		err = f.Close()
+	} else {
+		f.Close()
+	}
+	if err != nil {
+		os.Remove(fn)
+		return errutil.AddInfo(err, "file", fn)
+	}
+
+	logger := log.New()
+	logger.Info("exported texts", "locale", locale,
+		"count", len(units), "file", fn)
+	return nil
+}
+
+// importTexts reads translated texts, saves them into the
+// translation file of locale, and then builds. missing or stale
+// translations are reported by the build.
+func importTexts(configFilename, locale, fn string, warn bool) error {
+	err := checkTranslationFileName(fn)
+	if err != nil {
+		return err
+	}
+	c, err := loadTranslationConfig(configFilename, locale)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(fn)
+	if err != nil {
+		return err
+	}
+	var units []*transUnit
+	if translationFileExt(fn) == extPo {
+		units, err = readPo(f, locale)
+	} else {
+		units, err = readXliff(f, locale)
+	}
+	f.Close()
+	if err != nil {
+		return errutil.AddInfo(err, "file", fn)
+	}
+
+	entries := []*textEntry{}
+	err = ReadYamlFile(textExportFileName(c.ProtoPackage, c.TextLocale), &entries)
+	if err != nil && ! errutil.IsNotExist(err) {
+		return err
+	}
+	known := map[string]bool{}
+	for _, e := range entries {
+		known[e.Key] = true
+	}
+	trFn := translationFileName(locale)
+	translations := map[string]*translation{}
+	err = ReadYamlFile(trFn, &translations)
+	if err != nil && ! errutil.IsNotExist(err) {
+		return err
+	}
+
+	logger := log.New()
+	imported := 0
+	unknown := []string{}
+	for _, u := range units {
+		if len(u.Target) == 0 || u.Stale {
+			continue
+		}
+		if ! known[u.Key] {
+			unknown = append(unknown, u.Key)
+			continue
+		}
+		translations[u.Key] = &translation{ Source: u.Source, Text: u.Target }
+		imported++
+	}
+	if len(unknown) > 0 {
+		logger.Warn("texts not found. translations are ignored",
+			"locale", locale, "count", len(unknown),
+			"keys", strings.Join(unknown, " "))
+	}
+
+	err = os.MkdirAll(textDir, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	err = WriteYamlFile(trFn, translations)
+	if err != nil {
+		return err
+	}
+	logger.Info("imported translations", "locale", locale,
+		"count", imported, "file", trFn)
+
+	return process(configFilename, false, warn)
+}
+
+func loadTranslationConfig(configFilename, locale string) (*config, error) {
+	c, err := loadConfig(configFilename)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range c.Locales {
+		if l == locale {
+			return c, nil
+		}
+	}
+	return nil, errutil.New(ErrUnknownLocale,
+		errutil.MoreInfo, "locale must be one of Locales of config",
+		"locale", locale)
+}
+
+func translationFileExt(fn string) string {
+	_, _, ext := DecomposePath(fn)
+	return strings.ToLower(ext)
+}
+
+func checkTranslationFileName(fn string) error {
+	switch translationFileExt(fn) {
+	case extXliff, extXlf, extPo:
+		return nil
+	}
+	return errutil.New(ErrInvalidTranslationFile,
+		errutil.MoreInfo, "file type must be one of " +
+			strings.Join([]string{ extXliff, extXlf, extPo }, " "),
+		"file", fn)
+}
+
+// textContext returns the description of where the text is from.
+func textContext(e *textEntry) string {
+	ctx := fmt.Sprintf("table: %s, row: %s, field: %s",
+		e.Table, e.RowKey, e.Field)
+	if len(e.Loc) > 0 {
+		ctx += ", loc: " + e.Loc
+	}
+	return ctx
+}
+
+/////////////////////////////////////////////////////////////////////
+// XLIFF 1.2
+
+const xliffNamespace = "urn:oasis:names:tc:xliff:document:1.2"
+
+type xliffDoc struct {
+	XMLName xml.Name   `xml:"xliff"`
+	Xmlns   string     `xml:"xmlns,attr,omitempty"`
+	Version string     `xml:"version,attr"`
+	File    xliffFile  `xml:"file"`
+}
+
+type xliffFile struct {
+	Original       string `xml:"original,attr"`
+	SourceLanguage string `xml:"source-language,attr"`
+	TargetLanguage string `xml:"target-language,attr"`
+	Datatype       string `xml:"datatype,attr"`
+	Units          []*xliffUnit `xml:"body>trans-unit"`
+}
+
+type xliffUnit struct {
+	Id     string       `xml:"id,attr"`
+	Source string       `xml:"source"`
+	Target *xliffTarget `xml:"target,omitempty"`
+	Note   string       `xml:"note,omitempty"`
+}
+
+type xliffTarget struct {
+	State string `xml:"state,attr,omitempty"`
+	Text  string `xml:",chardata"`
+}
+
+func writeXliff(w io.Writer, original, srcLocale, locale string,
+	units []*transUnit) error {
+
+	doc := &xliffDoc{
+		Xmlns: xliffNamespace,
+		Version: "1.2",
+		File: xliffFile{
+			Original: original,
+			SourceLanguage: srcLocale,
+			TargetLanguage: locale,
+			Datatype: "plaintext",
+			Units: make([]*xliffUnit, len(units)) } }
+	for k, u := range units {
+		xu := &xliffUnit{ Id: u.Key, Source: u.Source,
+			Note: textContext(u.Entry) }
+		if len(u.Target) > 0 {
+			xu.Target = &xliffTarget{ State: "translated", Text: u.Target }
+			if u.Stale {
+				xu.Target.State = "needs-review-translation"
+			}
+		}
+		doc.File.Units[k] = xu
+	}
+
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	err = enc.Encode(doc)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+// readXliff reads translated units. units of which state is
+// needs-review-* are regarded as stale.
+func readXliff(r io.Reader, locale string) ([]*transUnit, error) {
+	doc := &xliffDoc{}
+	err := xml.NewDecoder(r).Decode(doc)
+	if err != nil {
+		return nil, errutil.Embed(ErrInvalidTranslationFile, err)
+	}
+	if doc.File.TargetLanguage != locale {
+		return nil, errutil.New(ErrInvalidTranslationFile,
+			errutil.MoreInfo, "target language mismatch",
+			"locale", locale, "target_language", doc.File.TargetLanguage)
+	}
+	units := []*transUnit{}
+	for _, xu := range doc.File.Units {
+		u := &transUnit{ Key: xu.Id, Source: xu.Source }
+		if xu.Target != nil {
+			u.Target = xu.Target.Text
+			u.Stale = strings.HasPrefix(xu.Target.State, "needs-review")
+		}
+		units = append(units, u)
+	}
+	return units, nil
+}
+
+/////////////////////////////////////////////////////////////////////
+// gettext PO
+
+func writePo(w io.Writer, srcLocale, locale string, units []*transUnit) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "msgid \"\"\nmsgstr \"\"\n")
+	fmt.Fprintf(bw, "%s\n", poQuote("Content-Type: text/plain; charset=UTF-8\n"))
+	fmt.Fprintf(bw, "%s\n", poQuote("Language: " + locale + "\n"))
+	fmt.Fprintf(bw, "%s\n", poQuote("X-Source-Language: " + srcLocale + "\n"))
+	for _, u := range units {
+		fmt.Fprintf(bw, "\n#. %s\n", textContext(u.Entry))
+		if u.Stale {
+			fmt.Fprintf(bw, "#, fuzzy\n")
+		}
+		fmt.Fprintf(bw, "msgctxt %s\n", poQuote(u.Key))
+		fmt.Fprintf(bw, "msgid %s\n", poQuote(u.Source))
+		fmt.Fprintf(bw, "msgstr %s\n", poQuote(u.Target))
+	}
+	return bw.Flush()
+}
+
+func poQuote(s string) string {
+	return strconv.Quote(s)
+}
+
+// readPo reads translated entries. fuzzy entries are regarded as stale.
+// plural forms are not supported.
+func readPo(r io.Reader, locale string) ([]*transUnit, error) {
+	units := []*transUnit{}
+	var cur *transUnit
+	// field to which continued string is appended
+	var field *string
+	fuzzy := false
+	language := ""
+	hasMsgStr := false
+
+	flush := func() {
+		if cur == nil {
+			return
+		}
+		if len(cur.Key) == 0 && len(cur.Source) == 0 {
+			// header
+			for _, h := range strings.Split(cur.Target, "\n") {
+				if strings.HasPrefix(h, "Language:") {
+					language = strings.TrimSpace(strings.TrimPrefix(h, "Language:"))
+				}
+			}
+		} else {
+			cur.Stale = fuzzy
+			units = append(units, cur)
+		}
+		cur = nil
+		field = nil
+		fuzzy = false
+		hasMsgStr = false
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 {
+			flush()
+			continue
+		}
+		if line[0] == '#' {
+			if hasMsgStr {
+				// comments of next entry without blank line
+				flush()
+			}
+			if strings.HasPrefix(line, "#,") && strings.Contains(line, "fuzzy") {
+				fuzzy = true
+			}
+			continue
+		}
+
+		keyword := ""
+		rest := line
+		if line[0] != '"' {
+			sp := strings.IndexAny(line, " \t")
+			if sp < 0 {
+				return nil, errutil.New(ErrInvalidTranslationFile,
+					"line", strconv.Itoa(lineNo))
+			}
+			keyword, rest = line[:sp], strings.TrimSpace(line[sp:])
+		}
+		s, err := strconv.Unquote(rest)
+		if err != nil {
+			return nil, errutil.Embed(ErrInvalidTranslationFile, err,
+				"line", strconv.Itoa(lineNo))
+		}
+		if (keyword == "msgctxt" || keyword == "msgid") && hasMsgStr {
+			// next entry without blank line
+			flush()
+		}
+		if cur == nil {
+			cur = &transUnit{}
+		}
+		switch keyword {
+		case "":
+			if field == nil {
+				return nil, errutil.New(ErrInvalidTranslationFile,
+					"line", strconv.Itoa(lineNo))
+			}
+			*field += s
+			continue
+		case "msgctxt":
+			field = &cur.Key
+		case "msgid":
+			field = &cur.Source
+		case "msgstr":
+			field = &cur.Target
+			hasMsgStr = true
+		default:
+			return nil, errutil.New(ErrInvalidTranslationFile,
+				errutil.MoreInfo, "unsupported keyword",
+				"keyword", keyword, "line", strconv.Itoa(lineNo))
+		}
+		*field = s
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errutil.Embed(ErrInvalidTranslationFile, err)
+	}
+	flush()
+
+	if len(language) > 0 && language != locale {
+		return nil, errutil.New(ErrInvalidTranslationFile,
+			errutil.MoreInfo, "language mismatch",
+			"locale", locale, "language", language)
+	}
+	return units, nil
+}
+
+func init() {
+	ErrUnknownLocale = errors.New("알 수 없는 locale")
+	ErrInvalidTranslationFile = errors.New("번역 파일이 잘못됨")
+}
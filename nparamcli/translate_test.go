@@ -0,0 +1,133 @@
+package nparamcli
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func testTransUnits() []*transUnit {
+	e := &textEntry{ Table: "Item", RowKey: "Sword", Field: "desc",
+		Loc: "a.xlsx!Item!C3" }
+	return []*transUnit{
+		{ Key: "Item.Sword.desc", Source: "a \"sharp\" sword",
+			Target: "\"날카로운\" 검", Entry: e },
+		{ Key: "Item.Bow.desc", Source: "line 1\nline 2\ttab \\ <b>&amp;</b>",
+			Target: "줄 1\n줄 2\t탭 \\ <b>&amp;</b>", Entry: e },
+		{ Key: "Item.Axe.desc", Source: "axe", Target: "도끼", Stale: true,
+			Entry: e },
+		{ Key: "Item.Mace.desc", Source: "mace", Entry: e },
+	}
+}
+
+func checkTransUnits(t *testing.T, got, want []*transUnit) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("%d units, want %d", len(got), len(want))
+	}
+	for k, u := range got {
+		w := want[k]
+		if u.Key != w.Key || u.Source != w.Source ||
+			u.Target != w.Target || u.Stale != w.Stale {
+			t.Errorf("unit %d: %q %q %q %v, want %q %q %q %v", k,
+				u.Key, u.Source, u.Target, u.Stale,
+				w.Key, w.Source, w.Target, w.Stale)
+		}
+	}
+}
+
+func TestTranslationRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		write func(*bytes.Buffer, []*transUnit) error
+		read  func(*bytes.Buffer, string) ([]*transUnit, error)
+	}{
+		{
+			"po",
+			func(b *bytes.Buffer, units []*transUnit) error {
+				return writePo(b, "en", "ko", units)
+			},
+			func(b *bytes.Buffer, locale string) ([]*transUnit, error) {
+				return readPo(b, locale)
+			},
+		},
+		{
+			"xliff",
+			func(b *bytes.Buffer, units []*transUnit) error {
+				return writeXliff(b, "game", "en", "ko", units)
+			},
+			func(b *bytes.Buffer, locale string) ([]*transUnit, error) {
+				return readXliff(b, locale)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			units := testTransUnits()
+			b := &bytes.Buffer{}
+			err := tt.write(b, units)
+			if err != nil {
+				t.Fatal(err)
+			}
+			written := b.String()
+			got, err := tt.read(b, "ko")
+			if err != nil {
+				t.Fatalf("%v\n%s", err, written)
+			}
+			checkTransUnits(t, got, units)
+
+			_, err = tt.read(bytes.NewBufferString(written), "ja")
+			if err == nil ||
+				! strings.Contains(err.Error(), ErrInvalidTranslationFile.Error()) {
+				t.Errorf("locale mismatch: error %v", err)
+			}
+		})
+	}
+}
+
+func TestReadPo(t *testing.T) {
+	content := strings.Join([]string{
+		`# translator comment`,
+		`msgid ""`,
+		`msgstr ""`,
+		`"Content-Type: text/plain; charset=UTF-8\n"`,
+		`"Language: ko\n"`,
+		``,
+		`#. table: Item, row: Sword, field: desc`,
+		`msgctxt "Item.Sword.desc"`,
+		`msgid ""`,
+		`"long "`,
+		`"text\n"`,
+		`msgstr "긴 "`,
+		`"글"`,
+		`#, fuzzy, c-format`,
+		`msgctxt "Item.Bow.desc"`,
+		`msgid "bow"`,
+		`msgstr "활"`,
+		`msgctxt "Item.Axe.desc"`,
+		`msgid "axe"`,
+		`msgstr ""`,
+	}, "\n")
+	got, err := readPo(strings.NewReader(content), "ko")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTransUnits(t, got, []*transUnit{
+		{ Key: "Item.Sword.desc", Source: "long text\n", Target: "긴 글" },
+		{ Key: "Item.Bow.desc", Source: "bow", Target: "활", Stale: true },
+		{ Key: "Item.Axe.desc", Source: "axe" },
+	})
+
+	for _, bad := range []string{
+		"msgid \"a\"\nmsgstr \"b\nc\"\n",
+		"msgid_plural \"a\"\n",
+		"\"continued without keyword\"\n",
+		"msgid\n",
+	} {
+		_, err := readPo(strings.NewReader(bad), "ko")
+		if err == nil ||
+			! strings.Contains(err.Error(), ErrInvalidTranslationFile.Error()) {
+			t.Errorf("%q: error %v", bad, err)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package nparamcli
+
+import (
+	"os"
+	"time"
+
+	log "gopkg.in/inconshreveable/log15.v2"
+)
+
+const (
+	watchPollInterval = 500 * time.Millisecond
+	// rebuild starts after input files stay unchanged for this long,
+	// so that a save in progress is not picked up.
+	watchDebounce = 1500 * time.Millisecond
+)
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+func Watch(warn bool) error {
+	return watch(configFileName(), warn)
+}
+
+// watch builds once, and then rebuilds whenever input files or
+// config file change. process is incremental, so only the stages
+// affected by the changed files do actual work.
+func watch(configFilename string, warn bool) error {
+	c, err := loadConfig(configFilename)
+	if err != nil {
+		return err
+	}
+	sources, locales := c.Sources, c.Locales
+	logger := log.New()
+
+	watchRebuild(logger, configFilename, warn, nil)
+	prev := watchSnapshot(configFilename, sources, locales)
+	logger.Info("watching input files. press ctrl-c to stop.")
+
+	for {
+		time.Sleep(watchPollInterval)
+		// if config file is broken, keep watching the previous sources.
+		// the error is reported by the build.
+		c, err := loadConfig(configFilename)
+		if err == nil {
+			sources, locales = c.Sources, c.Locales
+		}
+		cur := watchSnapshot(configFilename, sources, locales)
+		changed := diffSnapshots(prev, cur)
+		if len(changed) == 0 {
+			continue
+		}
+
+		cur, more := waitUnchanged(cur,
+			func() { time.Sleep(watchDebounce) },
+			func() map[string]fileStamp {
+				return watchSnapshot(configFilename, sources, locales)
+			})
+		changed = append(changed, more...)
+
+		watchRebuild(logger, configFilename, warn, changed)
+		// files saved during the build are picked up in the next loop.
+		prev = cur
+	}
+}
+
+// waitUnchanged calls wait and then snapshot repeatedly, until
+// snapshot is the same as the previous one, so that a save in progress
+// is not picked up. returns the last snapshot and the files changed
+// in the meantime.
+func waitUnchanged(cur map[string]fileStamp, wait func(),
+	snapshot func() map[string]fileStamp) (map[string]fileStamp, []string) {
+
+	changed := []string{}
+	for {
+		wait()
+		next := snapshot()
+		more := diffSnapshots(cur, next)
+		cur = next
+		if len(more) == 0 {
+			return cur, changed
+		}
+		changed = append(changed, more...)
+	}
+}
+
+func watchRebuild(logger log.Logger,
+	configFilename string, warn bool, changed []string) {
+
+	if len(changed) > 0 {
+		logger.Info("input files changed", "files", uniqueStrings(changed))
+	}
+	start := time.Now()
+	err := processWithLogger(logger, configFilename, false, warn)
+	elapsed := time.Since(start).Round(100*time.Millisecond)
+	if err != nil {
+		logger.Error("build failed", "elapsed", elapsed, "err", err.Error())
+	} else {
+		logger.Info("build ok", "elapsed", elapsed)
+	}
+}
+
+// watchSnapshot returns stamps of the config file, input files and
+// translation files. input files are searched every time, so that
+// added or deleted files are detected.
+func watchSnapshot(configFilename string,
+	sources []*sourceDef, locales []string) map[string]fileStamp {
+
+	fns, err := findSourceFiles(sources)
+	if err != nil {
+		// e.g. source dir is removed. then every input file is
+		// regarded as deleted, and the build will report the error.
+		fns = nil
+	}
+	fns = append(fns, configFilename)
+	others := map[string]bool{ configFilename: true }
+	for _, locale := range locales {
+		trFn := translationFileName(locale)
+		fns = append(fns, trFn)
+		others[trFn] = true
+	}
+
+	result := map[string]fileStamp{}
+	for _, fn := range fns {
+		if ! isInputFile(fn) && ! others[fn] {
+			continue
+		}
+		info, err := os.Stat(fn)
+		if err != nil {
+			// deleted in the meantime
+			continue
+		}
+		result[fn] = fileStamp{ modTime: info.ModTime(), size: info.Size() }
+	}
+	return result
+}
+
+func diffSnapshots(prev, cur map[string]fileStamp) []string {
+	changed := []string{}
+	for fn, s := range cur {
+		p, exists := prev[fn]
+		if ! exists || p != s {
+			changed = append(changed, fn)
+		}
+	}
+	for fn, _ := range prev {
+		_, exists := cur[fn]
+		if ! exists {
+			changed = append(changed, fn)
+		}
+	}
+	return changed
+}
+
+func uniqueStrings(sl []string) []string {
+	m := map[string]bool{}
+	result := []string{}
+	for _, s := range sl {
+		if ! m[s] {
+			m[s] = true
+			result = append(result, s)
+		}
+	}
+	return result
+}
@@ -0,0 +1,73 @@
+package nparamcli
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestDiffSnapshots(t *testing.T) {
+	t0 := time.Date(2016, 5, 17, 10, 0, 0, 0, time.UTC)
+	prev := map[string]fileStamp{
+		"same":    { t0, 10 },
+		"touched": { t0, 10 },
+		"resized": { t0, 10 },
+		"deleted": { t0, 10 },
+	}
+	cur := map[string]fileStamp{
+		"same":    { t0, 10 },
+		"touched": { t0.Add(time.Second), 10 },
+		"resized": { t0, 11 },
+		"added":   { t0, 10 },
+	}
+	changed := diffSnapshots(prev, cur)
+	sort.Strings(changed)
+	want := []string{ "added", "deleted", "resized", "touched" }
+	if ! reflect.DeepEqual(changed, want) {
+		t.Errorf("changed %v, want %v", changed, want)
+	}
+	if len(diffSnapshots(cur, cur)) != 0 {
+		t.Errorf("changed without change")
+	}
+}
+
+func TestWaitUnchanged(t *testing.T) {
+	t0 := time.Date(2016, 5, 17, 10, 0, 0, 0, time.UTC)
+	s := func(size int64) map[string]fileStamp {
+		return map[string]fileStamp{ "a": { t0, size } }
+	}
+	tests := []struct {
+		name    string
+		snaps   []map[string]fileStamp
+		waits   int
+		changed []string
+	}{
+		{ "already stable", []map[string]fileStamp{ s(1) }, 1, []string{} },
+		{
+			"save in progress",
+			[]map[string]fileStamp{ s(2), s(3), s(3) },
+			3, []string{ "a", "a" },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			waits, i := 0, 0
+			cur, changed := waitUnchanged(s(1),
+				func() { waits++ },
+				func() map[string]fileStamp {
+					i++
+					return tt.snaps[i-1]
+				})
+			if waits != tt.waits || i != waits {
+				t.Errorf("waits %d, snapshots %d, want %d", waits, i, tt.waits)
+			}
+			if ! reflect.DeepEqual(cur, tt.snaps[len(tt.snaps)-1]) {
+				t.Errorf("snapshot %v", cur)
+			}
+			if ! reflect.DeepEqual(changed, tt.changed) {
+				t.Errorf("changed %v, want %v", changed, tt.changed)
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/bluegol/errutil"
 	"github.com/tealeg/xlsx"
@@ -16,23 +17,19 @@ var (
 )
 
 func ParseXlsx(xlsxFn string) ([]*cdef, []*tableMeta, [][][]string, error) {
-	cdefs := []*cdef{}
-	tms := []*tableMeta{}
-	tds := [][][]string{}
-	tables := map[string]*tableMeta{}
-
 	xlFile, err := xlsx.OpenFile(xlsxFn)
 	if err != nil {
 		return nil, nil, nil, errutil.AssertEmbed(err, "file", xlsxFn)
 	}
-	// loop over workshets and process
-	for _, ws := range xlFile.Sheets {
-		// extract cells
+	// extract cells of each worksheet
+	wsNames := make([]string, len(xlFile.Sheets))
+	wsCells := make([][][]string, len(xlFile.Sheets))
+	for i, ws := range xlFile.Sheets {
 		cells := make([][]string, len(ws.Rows))
 		for j, row := range ws.Rows {
 			cells[j] = make([]string, len(row.Cells))
 			for k, cell := range row.Cells {
-				cells[j][k], err = cell.String()
+				cells[j][k], err = cellString(cell)
 				if err != nil {
 					return nil, nil, nil,
 						errutil.AssertEmbed(err,
@@ -41,14 +38,77 @@ func ParseXlsx(xlsxFn string) ([]*cdef, []*tableMeta, [][][]string, error) {
 				}
 			}
 		}
+		wsNames[i] = ws.Name
+		wsCells[i] = cells
+	}
+
+	return extractSheets(xlsxFn, wsNames, wsCells)
+}
+
+// cellString returns the text of cell. for cells of date or time format,
+// excel's date serial is returned instead of the formatted text such as
+// 10/17/26, which depends on the format and may drop the time.
+func cellString(cell *xlsx.Cell) (string, error) {
+	if isDateFormat(cell.GetNumberFormat()) {
+		return cell.Value, nil
+	}
+	return cell.String()
+}
+
+// isDateFormat reports whether excel's number format f is of date or
+// time, i.e. has any of y, m, d, h and s which is not quoted, escaped
+// or in brackets such as [Red]. elapsed time such as [h] is also of time.
+func isDateFormat(f string) bool {
+	inQuote, inBracket := false, false
+	for i := 0; i < len(f); i++ {
+		c := f[i]
+		switch {
+		case inQuote:
+			inQuote = c != '"'
+		case inBracket:
+			if c == ']' {
+				inBracket = false
+			} else if strings.ContainsRune("hmsHMS", rune(c)) &&
+				i > 0 && f[i-1] == '[' {
+				return true
+			}
+		case c == '"':
+			inQuote = true
+		case c == '[':
+			inBracket = true
+		case c == '\\' || c == '_' || c == '*':
+			// next character is literal or padding
+			i++
+		case strings.ContainsRune("ymdhsYMDHS", rune(c)):
+			return true
+		}
+	}
+	return false
+}
+
+// extractSheets extracts consts and tables from the cells of
+// each worksheet of spreadsheet file fn.
+func extractSheets(fn string, wsNames []string, wsCells [][][]string) (
+	[]*cdef, []*tableMeta, [][][]string, error) {
+
+	cdefs := []*cdef{}
+	tms := []*tableMeta{}
+	tds := [][][]string{}
+	tables := map[string]*tableMeta{}
 
-		cresult, err := extractConsts(ws.Name, cells)
+	// loop over workshets and process
+	for i, wsName := range wsNames {
+		cells := wsCells[i]
+		loc := func(r, c int) string {
+			return xlsxLoc(wsName, r, c)
+		}
+		cresult, err := extractConsts(loc, cells)
 		if err != nil {
-			return nil, nil, nil, errutil.AddInfo(err, "file", xlsxFn)
+			return nil, nil, nil, errutil.AddInfo(err, "file", fn)
 		}
 		cdefs = append(cdefs, cresult...)
 
-		tms2, tds2, err := extractTables(xlsxFn, ws.Name, cells)
+		tms2, tds2, err := extractTables(fn, loc, cells)
 		if err != nil {
 			return nil, nil, nil, err
 		}
@@ -68,7 +128,11 @@ func ParseXlsx(xlsxFn string) ([]*cdef, []*tableMeta, [][][]string, error) {
 	return cdefs, tms, tds, nil
 }
 
-func extractConsts(wsName string, cells [][]string) ([]*cdef, error) {
+// cellLocFunc returns the location of the cell at row r and column c,
+// both starting from 0, to be used in error messages.
+type cellLocFunc func(r, c int) string
+
+func extractConsts(loc cellLocFunc, cells [][]string) ([]*cdef, error) {
 	cdefs := []*cdef{}
 
 	for j, line := range cells {
@@ -76,28 +140,28 @@ func extractConsts(wsName string, cells [][]string) ([]*cdef, error) {
 			if c == kwConst {
 				if k+2 >= len(line) {
 					return nil, errutil.New(ErrXlsxInvalidConstDef,
-						"xlsxLoc", xlsxLoc(wsName, j, k))
+						"loc", loc(j, k))
 				}
 				v := line[k+2]
 				iv, err := strconv.Atoi(v)
 				if err != nil {
 					return nil, errutil.New(ErrXlsxInvalidConstDef,
 						errutil.MoreInfo, "not int",
-						"value", v, "xlsxLoc", xlsxLoc(wsName, j, k))
+						"value", v, "loc", loc(j, k))
 				}
 
 				cdefs = append(cdefs,
 					&cdef{
 						Name: line[k+1],
 						Value: iv,
-						XlsxLoc: xlsxLoc(wsName, j, k+1) } )
+						XlsxLoc: loc(j, k+1) } )
 			}
 		}
 	}
 	return cdefs, nil
 }
 
-func extractTables(xlsxFn, wsName string, cells [][]string) ([]*tableMeta, [][][]string, error) {
+func extractTables(xlsxFn string, loc cellLocFunc, cells [][]string) ([]*tableMeta, [][][]string, error) {
 	tms := []*tableMeta{}
 	rawdata := [][][]string{}
 
@@ -107,11 +171,11 @@ func extractTables(xlsxFn, wsName string, cells [][]string) ([]*tableMeta, [][][
 				continue
 			}
 
-			tLoc := xlsxLoc(wsName, j, k)
+			tLoc := loc(j, k)
 			if k+1 >= len(line) {
 				return nil, nil, errutil.New(ErrXlsxInvalidTableDef,
 					errutil.MoreInfo, "no table name",
-					"xlsxLoc", tLoc, "file", xlsxFn)
+					"loc", tLoc, "file", xlsxFn)
 			}
 			tName := line[k+1]
 			var tblOptStr string
@@ -122,7 +186,7 @@ func extractTables(xlsxFn, wsName string, cells [][]string) ([]*tableMeta, [][][
 			if err != nil {
 				return nil, nil, errutil.Embed(ErrXlsxInvalidTableDef, err,
 					errutil.MoreInfo, "invalid table options",
-					"table", tName, "xlsxLoc", tLoc, "file", xlsxFn)
+					"table", tName, "loc", tLoc, "file", xlsxFn)
 			}
 			// check end of rows
 			var numRows int
@@ -130,18 +194,18 @@ func extractTables(xlsxFn, wsName string, cells [][]string) ([]*tableMeta, [][][
 				if j+3 >= len(cells) {
 					return nil, nil, errutil.New(ErrXlsxInvalidTableDef,
 						errutil.MoreInfo, "no row",
-						"table", tName, "xlsxLoc", tLoc, "file", xlsxFn)
+						"table", tName, "loc", tLoc, "file", xlsxFn)
 				}
 				numRows = 1
 			} else {
 				if j+4 >= len(cells) {
 					return nil, nil, errutil.New(ErrXlsxInvalidTableDef,
 						errutil.MoreInfo, "no row",
-						"table", tName, "xlsxLoc", tLoc, "file", xlsxFn)
+						"table", tName, "loc", tLoc, "file", xlsxFn)
 				}
 				endRow := -1
 				for jj := j+4; jj < len(cells); jj++ {
-					if cells[jj][k] == kwEnd {
+					if k < len(cells[jj]) && cells[jj][k] == kwEnd {
 						endRow = jj
 						break
 					}
@@ -149,7 +213,7 @@ func extractTables(xlsxFn, wsName string, cells [][]string) ([]*tableMeta, [][][
 				if endRow < 0 {
 					return nil, nil, errutil.New(ErrXlsxInvalidTableDef,
 						errutil.MoreInfo, "no row end",
-						"table", tName, "xlsxLoc", tLoc, "file", xlsxFn)
+						"table", tName, "loc", tLoc, "file", xlsxFn)
 				}
 				numRows = endRow - (j + 3)
 			}
@@ -166,12 +230,12 @@ func extractTables(xlsxFn, wsName string, cells [][]string) ([]*tableMeta, [][][
 			if endCol < 0 {
 				return nil, nil, errutil.New(ErrXlsxInvalidTableDef,
 					errutil.MoreInfo, "no field end",
-					"table", tName, "xlsxLoc", tLoc, "file", xlsxFn)
+					"table", tName, "loc", tLoc, "file", xlsxFn)
 			}
 			if endCol-1 >= len(fieldOptLine) {
 				return nil, nil, errutil.New(ErrXlsxInvalidTableDef,
 					errutil.MoreInfo, "no field opt",
-					"table", tName, "xlsxLoc", tLoc, "file", xlsxFn)
+					"table", tName, "loc", tLoc, "file", xlsxFn)
 			}
 			numFields := endCol - k
 
@@ -184,8 +248,10 @@ func extractTables(xlsxFn, wsName string, cells [][]string) ([]*tableMeta, [][][
 
 			// get data
 			data := make([][]string, numRows)
+			tm.RowLocs = make([]string, numRows)
 			for jj := 0; jj < numRows; jj++ {
 				data[jj] = make([]string, numFields)
+				tm.RowLocs[jj] = loc(jj+j+3, k)
 				line := cells[jj+j+3]
 				for kk := 0; kk < numFields; kk++ {
 					if kk+k >= len(line) {
@@ -195,12 +261,7 @@ func extractTables(xlsxFn, wsName string, cells [][]string) ([]*tableMeta, [][][
 				}
 			}
 			// set autokeys
-			if tm.AutoKey() {
-				tm.AutoKeyNames = make([]string, numRows)
-				for jj, line := range data {
-					tm.AutoKeyNames[jj] = line[0]
-				}
-			}
+			tm.setAutoKeyNames(data)
 
 			tms = append(tms, tm)
 			rawdata = append(rawdata, data)
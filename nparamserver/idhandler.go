@@ -257,7 +257,7 @@ func init() {
 	ErrInvalidRequest = errors.New("invalid request")
 
 	reValidInternalSymbol, _ =
-		regexp.Compile(`^[_A-Za-z][0-9_A-Za-z]*(\.[_A-Za-z][0-9_A-Za-z]*){0,3}$`)
+		regexp.Compile(`^[_A-Za-z][0-9_A-Za-z]*(\.[_A-Za-z][0-9_A-Za-z]*)*$`)
 }
 const idTableName = "tbl"
 var selectQuery, insertQuery string